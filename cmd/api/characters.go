@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+	"strings"
+)
+
+func (app application) drawCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	character, balance, err := app.repositories.Characters.Draw(r.Context(), user.ID, app.config.gacha)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInsufficientCoins):
+			app.errorResponse(w, r, http.StatusPaymentRequired, "you do not have enough coins to draw a character")
+		case errors.Is(err, entity.ErrNoCharacters):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"character": character, "balance": balance}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listOwnedCharactersHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	rarity := readString(qs, "rarity", "")
+	filters := readFilters(qs, "id", "id", "-id")
+
+	v := validator.New()
+	v.Check(rarity == "" || validator.PermittedValue(rarity, entity.Rarities...), "rarity", "invalid rarity value")
+	if repository.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	characters, metadata, err := app.repositories.Characters.GetAllForUser(r.Context(), user.ID, rarity, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rarityCounts, err := app.repositories.Characters.CountRaritiesForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"characters":    characters,
+		"rarity_counts": rarityCounts,
+		"equipped_id":   user.CharacterID,
+		"metadata":      metadata,
+	}
+
+	err = writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) equipCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CharacterID int64 `json:"character_id"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.CharacterID > 0, "character_id", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	owns, err := app.repositories.Characters.Owns(r.Context(), user.ID, input.CharacterID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !owns {
+		v.AddError("character_id", "you do not own this character")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.CharacterID = input.CharacterID
+
+	err = app.repositories.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"user": *user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listCharactersHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	rarity := readString(qs, "rarity", "")
+	includeRetired := readBool(qs, "include_retired", false)
+	filters := readFilters(qs, "id", "id", "rarity", "created_at", "-id", "-rarity", "-created_at")
+
+	v := validator.New()
+	v.Check(rarity == "" || validator.PermittedValue(rarity, entity.Rarities...), "rarity", "invalid rarity value")
+	if repository.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	characters, metadata, err := app.repositories.Characters.GetAll(r.Context(), includeRetired, rarity, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"characters": characters, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) createCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	err := readMultipartForm(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	img, err := readImage(r, v, "image")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if img == nil {
+		v.AddError("image", "must be provided")
+	}
+
+	character := &entity.Character{
+		Rarity: r.PostFormValue("rarity"),
+	}
+
+	if entity.ValidateCharacter(v, character); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key, url, err := app.storeCharacterImage(img)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	character.ImageURL = url
+
+	err = app.repositories.Characters.Insert(r.Context(), character)
+	if err != nil {
+		app.deleteBlob(key)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"character": character}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) updateCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	character, err := app.repositories.Characters.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = readMultipartForm(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	img, err := readImage(r, v, "image")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if rarity, ok := r.PostForm["rarity"]; ok && len(rarity) > 0 {
+		character.Rarity = rarity[0]
+	}
+	if retired, ok := r.PostForm["retired"]; ok && len(retired) > 0 {
+		character.Retired = retired[0] == "true"
+	}
+
+	if entity.ValidateCharacter(v, character); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	oldURL := character.ImageURL
+
+	var key string
+	if img != nil {
+		key, character.ImageURL, err = app.storeCharacterImage(img)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.repositories.Characters.Update(r.Context(), character)
+	if err != nil {
+		if key != "" {
+			app.deleteBlob(key)
+		}
+
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if key != "" {
+		app.deleteCharacterImage(oldURL)
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"character": character}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) retireCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	character, err := app.repositories.Characters.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	character.Retired = true
+
+	v := validator.New()
+	if entity.ValidateCharacter(v, character); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.repositories.Characters.Update(r.Context(), character)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"character": character}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCharacterImage removes the stored image behind url. Images that are
+// not served from our own storage, like the ones seeded by the first
+// migration, are left alone.
+func (app application) deleteCharacterImage(url string) {
+	prefix := app.storage.URL("")
+	if !strings.HasPrefix(url, prefix) {
+		return
+	}
+
+	app.deleteBlob(strings.TrimPrefix(url, prefix))
+}
+
+func (app application) deleteBlob(key string) {
+	err := app.storage.Delete(key)
+	if err != nil {
+		app.logger.Error().
+			Err(err).
+			Str("key", key).
+			Msg("error deleting blob")
+	}
+}
@@ -1,37 +1,205 @@
 package main
 
 import (
-	"github.com/gorilla/schema"
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
 	"github.com/swsd2544/learny-backend-clone/internal/validator"
 	"net/http"
 )
 
 func (app application) getClassesHandler(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		app.badRequestResponse(w, r, err)
+	qs := r.URL.Query()
+
+	isEnrolled := readBool(qs, "is_enrolled", false)
+	filters := readFilters(qs, "id", "id", "name", "created_at", "-id", "-name", "-created_at")
+
+	v := validator.New()
+	if repository.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var enrolledUserID int64
+	if isEnrolled {
+		enrolledUserID = app.contextGetUser(r).ID
+	}
+
+	classes, metadata, err := app.repositories.Classes.GetAll(r.Context(), enrolledUserID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"classes": classes, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) showClassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	class, err := app.repositories.Classes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	var filter struct {
-		Offset     int64  `schema:"offset"`
-		Limit      int64  `schema:"limit"`
-		SortBy     string `schema:"sort_by"`
-		Asc        bool   `schema:"asc"`
-		IsEnrolled bool   `schema:"is_enrolled"`
+	err = writeJSON(w, http.StatusOK, envelope{"class": class}, versionHeaders(class.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-	if err := schema.NewDecoder().Decode(filter, r.Form); err != nil {
+}
+
+func (app application) createClassHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	class := &entity.Class{
+		Name:        input.Name,
+		Description: input.Description,
+		TeacherID:   app.contextGetUser(r).ID,
+	}
+
 	v := validator.New()
-	v.Check(filter.Offset >= 0, "offset", "must be positive")
-	v.Check(filter.Limit >= 0, "limit", "must be positive")
-	v.Check(validator.PermittedValue(filter.SortBy, "id", "name", "created_at"), "sort_by", "must be either id, name, or created_at")
+	if entity.ValidateClass(v, class); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.repositories.Classes.Insert(r.Context(), class)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"class": class}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) updateClassHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
 
-	if !v.Valid() {
+	expectedVersion, ok, err := readExpectedVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if ok && expectedVersion != class.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	err = readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		class.Name = *input.Name
+	}
+	if input.Description != nil {
+		class.Description = *input.Description
+	}
+
+	v := validator.New()
+	if entity.ValidateClass(v, class); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	err = app.repositories.Classes.Update(r.Context(), class)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"class": class}, versionHeaders(class.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) deleteClassHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.repositories.Classes.Delete(r.Context(), class.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "class successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnedClass loads the class named by the id route parameter and makes
+// sure the current user is the teacher who owns it. It writes the error
+// response itself and reports false when the handler should stop.
+func (app application) readOwnedClass(w http.ResponseWriter, r *http.Request) (*entity.Class, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	class, err := app.repositories.Classes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if class.TeacherID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return class, true
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUpdateClass(t *testing.T) {
+	app, user, token := newTestApplication(t)
+	routes := app.routes()
+
+	ctx := context.Background()
+	err := app.repositories.Permissions.AddForUser(ctx, user.ID, entity.PermissionClassesRead, entity.PermissionClassesWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class := &entity.Class{Name: "Algebra", Description: "Numbers and letters", TeacherID: user.ID}
+	err = app.repositories.Classes.Insert(ctx, class)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/v1/classes/" + strconv.FormatInt(class.ID, 10)
+
+	send := func(method, body string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(http.MethodGet, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d showing the class, want %d", w.Code, http.StatusOK)
+	}
+	etag := w.Header().Get("ETag")
+
+	// Two teachers read the class at the same version; only the first of
+	// their edits may go through.
+	w = send(http.MethodPatch, `{"name": "Geometry"}`, map[string]string{"If-Match": etag})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d updating the class, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	w = send(http.MethodPatch, `{"description": "Shapes"}`, map[string]string{"If-Match": etag})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d updating with a stale version, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = send(http.MethodPatch, `{"description": "Shapes"}`, map[string]string{"X-Expected-Version": "x"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d updating with a malformed version, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = send(http.MethodPatch, `{"description": "Shapes"}`, map[string]string{"X-Expected-Version": "2"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d updating with X-Expected-Version, want %d", w.Code, http.StatusOK)
+	}
+
+	updated, err := app.repositories.Classes.Get(ctx, class.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Geometry" || updated.Description != "Shapes" || updated.Version != 3 {
+		t.Fatalf("got %q, %q at version %d, want \"Geometry\", \"Shapes\" at version 3",
+			updated.Name, updated.Description, updated.Version)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+)
+
+func (app application) grantCoinsHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	studentID, err := readInt64Param(r, "student_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	enrolled, err := app.repositories.Enrollments.Exists(r.Context(), studentID, class.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !enrolled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Delta          int64  `json:"delta"`
+		Reason         string `json:"reason"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	err = readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.IdempotencyKey == "" {
+		input.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+
+	actorID := app.contextGetUser(r).ID
+	transaction := &entity.CoinTransaction{
+		UserID:         studentID,
+		Delta:          input.Delta,
+		Reason:         input.Reason,
+		ActorID:        &actorID,
+		ClassID:        &class.ID,
+		IdempotencyKey: input.IdempotencyKey,
+	}
+
+	v := validator.New()
+	if entity.ValidateCoinTransaction(v, transaction); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	balance, err := app.repositories.Coins.Apply(r.Context(), transaction)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInsufficientCoins):
+			v.AddError("delta", "the student does not have enough coins")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"transaction": transaction, "balance": balance}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listCoinTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	filters := readFilters(r.URL.Query(), "-id", "id", "-id")
+
+	v := validator.New()
+	if repository.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transactions, metadata, err := app.repositories.Coins.GetAllForUser(r.Context(), app.contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"transactions": transactions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
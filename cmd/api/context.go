@@ -8,7 +8,10 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey      = contextKey("user")
+	tokenHashContextKey = contextKey("token_hash")
+)
 
 func (app application) contextSetUser(r *http.Request, user *entity.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +25,15 @@ func (app application) contextGetUser(r *http.Request) *entity.User {
 	}
 	return user
 }
+
+func (app application) contextSetTokenHash(r *http.Request, hash []byte) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenHashContextKey, hash)
+	return r.WithContext(ctx)
+}
+
+// contextGetTokenHash returns the hash of the authentication token the
+// request was made with, or nil for anonymous requests.
+func (app application) contextGetTokenHash(r *http.Request) []byte {
+	hash, _ := r.Context().Value(tokenHashContextKey).([]byte)
+	return hash
+}
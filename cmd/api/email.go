@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestEmailChangeHandler starts an email change. The new address is only
+// stored as pending and receives a confirmation token, while the current
+// address is told about the request in case the account was taken over.
+func (app application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	entity.ValidateEmail(v, input.Email)
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		v.AddError("email", "must be different from the current email address")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.repositories.Users.GetUserWithEmail(r.Context(), input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, repository.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The pending address is only stored together with the one token that
+	// confirms it.
+	var token *entity.Token
+	err = app.repositories.Transactor.WithinTx(r.Context(), func(tx repository.Repositories) error {
+		err := tx.Users.SetPendingEmail(r.Context(), user.ID, input.Email)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Tokens.DeleteAllForUser(r.Context(), entity.ScopeEmailChange, user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err = tx.Tokens.New(r.Context(), user.ID, 24*time.Hour, entity.ScopeEmailChange)
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"emailChangeToken": token.Plaintext,
+			"firstname":        user.Firstname,
+			"email":            input.Email,
+		}
+
+		err := app.mailer.Send(input.Email, "email_change_confirm.tmpl", data)
+		if err != nil {
+			app.logger.Error().
+				Err(err).
+				Int64("user_id", user.ID).
+				Msg("error sending email change confirmation")
+		}
+
+		err = app.mailer.Send(user.Email, "email_change_notice.tmpl", data)
+		if err != nil {
+			app.logger.Error().
+				Err(err).
+				Int64("user_id", user.ID).
+				Msg("error sending email change notice")
+		}
+	})
+
+	env := envelope{"message": "an email will be sent to the new address containing confirmation instructions"}
+
+	err = writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithToken(r.Context(), entity.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.repositories.Transactor.WithinTx(r.Context(), func(tx repository.Repositories) error {
+		err := tx.Users.ConfirmPendingEmail(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		for _, scope := range []string{entity.ScopeEmailChange, entity.ScopePasswordReset} {
+			err = tx.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"user": *user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
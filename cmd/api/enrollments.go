@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+	"strings"
+)
+
+func (app application) rotateJoinCodeHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	code, err := entity.GenerateJoinCode()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.repositories.Classes.SetJoinCode(r.Context(), class.ID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"join_code": code}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) joinClassHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		JoinCode string `json:"join_code"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.JoinCode = strings.ToUpper(strings.TrimSpace(input.JoinCode))
+
+	v := validator.New()
+	if entity.ValidateJoinCode(v, input.JoinCode); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	class, err := app.repositories.Classes.GetWithJoinCode(r.Context(), input.JoinCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("join_code", "invalid join code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.repositories.Enrollments.Insert(r.Context(), app.contextGetUser(r).ID, class.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAlreadyEnrolled):
+			v.AddError("join_code", "you are already enrolled in this class")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"class": class}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) leaveClassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.repositories.Enrollments.Delete(r.Context(), app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "successfully left the class"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listClassStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	filters := readFilters(r.URL.Query(), "id", "id", "username", "firstname", "lastname",
+		"-id", "-username", "-firstname", "-lastname")
+
+	v := validator.New()
+	if repository.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	students, metadata, err := app.repositories.Users.GetUsersWithClassID(r.Context(), class.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"students": students, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) addClassStudentHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	student, ok := app.readStudentByEmail(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.repositories.Enrollments.Insert(r.Context(), student.ID, class.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAlreadyEnrolled):
+			v := validator.New()
+			v.AddError("email", "the student is already enrolled in this class")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusCreated, envelope{"student": student}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) removeClassStudentHandler(w http.ResponseWriter, r *http.Request) {
+	class, ok := app.readOwnedClass(w, r)
+	if !ok {
+		return
+	}
+
+	student, ok := app.readStudentByEmail(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.repositories.Enrollments.Delete(r.Context(), student.ID, class.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "student successfully removed from the class"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readStudentByEmail reads a {"email": ...} body and loads the student it
+// names. It writes the error response itself and reports false when the
+// handler should stop.
+func (app application) readStudentByEmail(w http.ResponseWriter, r *http.Request) (*entity.User, bool) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	v := validator.New()
+	if entity.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	student, err := app.repositories.Users.GetUserWithEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("email", "no student with this email address")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if student.Role != entity.RoleStudent {
+		v.AddError("email", "no student with this email address")
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	return student, true
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
 	"net/http"
 )
 
@@ -9,7 +12,8 @@ func (app application) logError(r *http.Request, err error) {
 	app.logger.Error().
 		Err(err).
 		Str("method", r.Method).
-		Str("url", r.URL.String())
+		Str("url", r.URL.String()).
+		Msg("error processing request")
 }
 
 func (app application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
@@ -23,12 +27,45 @@ func (app application) errorResponse(w http.ResponseWriter, r *http.Request, sta
 }
 
 func (app application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err),
+		errors.As(err, &pgErr) && pgErr.Code == "57014":
+		app.timeoutResponse(w, r, err)
+		return
+	case errors.Is(err, context.Canceled):
+		app.canceledResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// timeoutResponse is sent when a database query ran out of time, so that
+// clients can tell an overloaded server from a broken request.
+func (app application) timeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := "the server took too long to process your request, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
+// canceledResponse is sent when a query was canceled along with the request,
+// usually because the client went away or the server is shutting down.
+func (app application) canceledResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warn().
+		Err(err).
+		Str("method", r.Method).
+		Str("url", r.URL.String()).
+		Msg("request canceled")
+
+	message := "the server is unable to process your request right now, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
 func (app application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
 	app.errorResponse(w, r, http.StatusNotFound, message)
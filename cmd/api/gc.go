@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// collectExpired calls deleteBatch with batchSize until it deletes fewer rows
+// than that, stopping early when done is closed. It returns the number of
+// deleted rows.
+func collectExpired(done <-chan struct{}, batchSize int, deleteBatch func(ctx context.Context, batchSize int) (int64, error)) (int64, error) {
+	var total int64
+
+	for {
+		deleted, err := deleteBatch(context.Background(), batchSize)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+
+		select {
+		case <-done:
+			return total, nil
+		default:
+		}
+	}
+}
+
+// collectGarbage deletes expired tokens and stale login failures, logging
+// how many of each were deleted.
+func (app application) collectGarbage(done <-chan struct{}, batchSize int) error {
+	collections := []struct {
+		what        string
+		deleteBatch func(ctx context.Context, batchSize int) (int64, error)
+	}{
+		{"expired tokens", app.repositories.Tokens.DeleteExpired},
+		{"stale login failures", app.repositories.Logins.DeleteStale},
+	}
+
+	for _, c := range collections {
+		start := time.Now()
+
+		deleted, err := collectExpired(done, batchSize, c.deleteBatch)
+		if err != nil {
+			return fmt.Errorf("deleting %s after %d rows: %w", c.what, deleted, err)
+		}
+
+		app.logger.Info().
+			Int64("deleted", deleted).
+			Dur("duration", time.Since(start)).
+			Msg("deleted " + c.what)
+	}
+
+	return nil
+}
+
+// runTokenCollector calls collectGarbage every interval until done is
+// closed.
+func (app application) runTokenCollector(done <-chan struct{}, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := app.collectGarbage(done, batchSize)
+			if err != nil {
+				app.logger.Error().
+					Err(err).
+					Msg("error collecting garbage")
+			}
+		case <-done:
+			return
+		}
+	}
+}
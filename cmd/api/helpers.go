@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -13,10 +15,14 @@ import (
 )
 
 func readIDParam(r *http.Request) (int64, error) {
+	return readInt64Param(r, "id")
+}
+
+func readInt64Param(r *http.Request, key string) (int64, error) {
 	params := mux.Vars(r)
-	id, err := strconv.ParseInt(params["id"], 10, 64)
+	id, err := strconv.ParseInt(params[key], 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", key)
 	}
 
 	return id, nil
@@ -139,3 +145,125 @@ func readInt(qs url.Values, key string, defaultValue int) int {
 
 	return i
 }
+
+func readInt64(qs url.Values, key string, defaultValue int64) int64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return i
+}
+
+// readFilters reads the page, page_size, sort and after query string
+// parameters shared by every list endpoint.
+func readFilters(qs url.Values, defaultSort string, sortSafelist ...string) repository.Filters {
+	return repository.Filters{
+		Page:         readInt(qs, "page", 1),
+		PageSize:     readInt(qs, "page_size", 20),
+		Sort:         readString(qs, "sort", defaultSort),
+		SortSafelist: sortSafelist,
+		After:        readInt64(qs, "after", 0),
+	}
+}
+
+// clientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only believed when the request comes from a
+// trusted proxy, and then read from the right, skipping every address that
+// belongs to a trusted proxy itself.
+func (app application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !app.isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !app.isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (app application) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range app.config.limiter.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (app application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error().
+					Err(fmt.Errorf("%s", err)).
+					Msg("recovered panic in background task")
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// readExpectedVersion reads the version the client expects a resource to be
+// at from the If-Match header (as sent back from an ETag) or, failing that,
+// the X-Expected-Version header. The boolean is false when neither is set.
+func readExpectedVersion(r *http.Request) (int64, bool, error) {
+	s := r.Header.Get("If-Match")
+	if s != "" {
+		s = strings.TrimPrefix(s, "W/")
+		s = strings.Trim(s, `"`)
+	} else {
+		s = r.Header.Get("X-Expected-Version")
+	}
+
+	if s == "" {
+		return 0, false, nil
+	}
+
+	version, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid expected version header")
+	}
+
+	return version, true, nil
+}
+
+// versionHeaders returns an ETag header carrying the version of a resource
+// for clients to send back in If-Match.
+func versionHeaders(version int64) http.Header {
+	headers := make(http.Header)
+	headers.Set("ETag", fmt.Sprintf(`"%d"`, version))
+	return headers
+}
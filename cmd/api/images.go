@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	maxImageBytes     = 2 << 20 // 2 MB
+	minImageDimension = 64
+	maxImageDimension = 2048
+)
+
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+type imageUpload struct {
+	data      []byte
+	extension string
+}
+
+func readMultipartForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+
+	err := r.ParseMultipartForm(maxImageBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return fmt.Errorf("body must be a valid multipart form: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readImage reads and checks the image uploaded in the key field of an
+// already parsed multipart form. It returns nil when no file was uploaded
+// and records any problem with the file in v.
+func readImage(r *http.Request, v *validator.Validator, key string) (*imageUpload, error) {
+	file, _, err := r.FormFile(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, http.ErrMissingFile):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxImageBytes {
+		v.AddError(key, fmt.Sprintf("must not be larger than %d bytes", maxImageBytes))
+		return nil, nil
+	}
+
+	extension, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		v.AddError(key, "must be a PNG, JPEG or GIF image")
+		return nil, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		v.AddError(key, "must be a valid image")
+		return nil, nil
+	}
+
+	v.Check(config.Width >= minImageDimension && config.Height >= minImageDimension, key,
+		fmt.Sprintf("must be at least %dx%d pixels", minImageDimension, minImageDimension))
+	v.Check(config.Width <= maxImageDimension && config.Height <= maxImageDimension, key,
+		fmt.Sprintf("must be at most %dx%d pixels", maxImageDimension, maxImageDimension))
+
+	if !v.Valid() {
+		return nil, nil
+	}
+
+	return &imageUpload{data: data, extension: extension}, nil
+}
+
+// storeCharacterImage saves the image under a random key and returns the
+// key together with the public URL it is served from.
+func (app application) storeCharacterImage(img *imageUpload) (string, string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := "characters/" + hex.EncodeToString(randomBytes) + img.extension
+
+	err = app.storage.Put(key, bytes.NewReader(img.data))
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, app.storage.URL(key), nil
+}
+
+// serveStatic serves the files kept under dir in local storage. Directory
+// listings and hidden files, such as in-progress uploads, are not served.
+func (app application) serveStatic(dir string) http.Handler {
+	fileServer := http.FileServer(http.Dir(filepath.Join(app.config.storage.dir, dir)))
+
+	return http.StripPrefix("/static/"+dir, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.HasPrefix(path.Base(r.URL.Path), ".") {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	}))
+}
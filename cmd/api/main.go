@@ -2,11 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/mailer"
 	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/secretbox"
+	"github.com/swsd2544/learny-backend-clone/internal/storage"
+	"github.com/swsd2544/learny-backend-clone/internal/totp"
+	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,14 +25,62 @@ type config struct {
 	port        int
 	environment string
 	db          struct {
-		dsn string
+		dsn          string
+		queryTimeout time.Duration
+		isolation    string
+		autoMigrate  bool
+	}
+	mailer struct {
+		sink string
+		dir  string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	teacherInviteCode string
+	gacha             entity.Banner
+	storage           struct {
+		dir string
+	}
+	tokens struct {
+		authenticationTTL time.Duration
+		refreshTTL        time.Duration
+		gcInterval        time.Duration
+		gcBatchSize       int
+	}
+	login struct {
+		account entity.LoginPolicy
+		client  entity.LoginPolicy
+	}
+	limiter struct {
+		enabled        bool
+		rps            float64
+		burst          int
+		lookupRPS      float64
+		lookupBurst    int
+		trustedProxies []*net.IPNet
+	}
+	totp struct {
+		key string
 	}
 }
 
 type application struct {
-	config       config
-	logger       zerolog.Logger
-	repositories repository.Repositories
+	config        config
+	logger        zerolog.Logger
+	repositories  repository.Repositories
+	mailer        mailer.Mailer
+	storage       storage.Blob
+	tokenUsage    *tokenUsage
+	limiter       *rateLimiter
+	lookupLimiter *rateLimiter
+	totp          totp.TOTP
+	secrets       *secretbox.Box
+	wg            *sync.WaitGroup
 }
 
 func main() {
@@ -30,11 +89,116 @@ func main() {
 	flag.IntVar(&config.port, "port", 4000, "API server port")
 	flag.StringVar(&config.environment, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&config.db.dsn, "db-dsn", os.Getenv("LEARNY_DB_DSN"), "Postgres DSN")
+	flag.DurationVar(&config.db.queryTimeout, "db-query-timeout", 3*time.Second, "Maximum duration of a database query")
+	flag.StringVar(&config.db.isolation, "db-isolation", "read committed",
+		"Isolation level of multi-repository transactions (read committed|repeatable read|serializable)")
+	flag.BoolVar(&config.db.autoMigrate, "auto-migrate", false, "Apply pending database migrations before starting the server")
+
+	flag.StringVar(&config.mailer.sink, "mailer", "stdout", "Mailer sink (smtp|file|stdout)")
+	flag.StringVar(&config.mailer.dir, "mailer-dir", "tmp/mail", "Directory for the file mailer sink")
+
+	flag.StringVar(&config.smtp.host, "smtp-host", os.Getenv("LEARNY_SMTP_HOST"), "SMTP host")
+	flag.IntVar(&config.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&config.smtp.username, "smtp-username", os.Getenv("LEARNY_SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&config.smtp.password, "smtp-password", os.Getenv("LEARNY_SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&config.smtp.sender, "smtp-sender", "Learny <no-reply@learny.local>", "SMTP sender")
+
+	flag.StringVar(&config.teacherInviteCode, "teacher-invite-code", os.Getenv("LEARNY_TEACHER_INVITE_CODE"),
+		"Invite code required to register a teacher account (registration is disabled when empty)")
+
+	flag.Int64Var(&config.gacha.Cost, "gacha-cost", 100, "Coin cost of a character draw")
+	flag.IntVar(&config.gacha.Pity, "gacha-pity", 50, "Draws after which a legendary or better is guaranteed (0 disables)")
+	gachaWeights := flag.String("gacha-weights", "common:70,rare:25,legendary:4,mystic:1", "Relative rarity weights of a character draw")
+
+	flag.StringVar(&config.storage.dir, "storage-dir", "tmp/storage", "Directory uploaded files are stored in")
+
+	flag.DurationVar(&config.tokens.authenticationTTL, "auth-token-ttl", 24*time.Hour, "Lifetime of authentication tokens")
+	flag.DurationVar(&config.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+
+	flag.DurationVar(&config.tokens.gcInterval, "token-gc-interval", time.Hour, "Interval between clean-ups of expired tokens and stale login failures")
+	flag.IntVar(&config.tokens.gcBatchSize, "token-gc-batch-size", 1000, "Maximum number of expired tokens or stale login failures deleted per statement")
+
+	config.login.account = entity.LoginPolicy{FreeAttempts: 3, BaseDelay: time.Second, Window: time.Hour}
+	config.login.client = entity.LoginPolicy{FreeAttempts: 20, BaseDelay: time.Second, Window: time.Hour}
+
+	flag.IntVar(&config.login.account.MaxAttempts, "login-max-attempts", 10, "Failed logins after which an account is locked out")
+	flag.IntVar(&config.login.client.MaxAttempts, "login-max-attempts-ip", 100, "Failed logins after which a client IP is locked out")
+	flag.DurationVar(&config.login.account.Lockout, "login-lockout", 15*time.Minute, "Duration of a login lockout")
+
+	flag.BoolVar(&config.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&config.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second per client")
+	flag.IntVar(&config.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst per client")
+	flag.Float64Var(&config.limiter.lookupRPS, "limiter-lookup-rps", 50, "Rate limiter maximum bearer token lookups per second per client IP")
+	flag.IntVar(&config.limiter.lookupBurst, "limiter-lookup-burst", 100, "Rate limiter maximum burst of bearer token lookups per client IP")
+
+	flag.Func("trusted-proxies", "Comma separated CIDRs of proxies whose X-Forwarded-For header is trusted", func(s string) error {
+		for _, cidr := range strings.Split(s, ",") {
+			_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return err
+			}
+			config.limiter.trustedProxies = append(config.limiter.trustedProxies, network)
+		}
+		return nil
+	})
+
+	flag.StringVar(&config.totp.key, "totp-key", os.Getenv("LEARNY_TOTP_KEY"),
+		"Hex encoded 32 byte key encrypting TOTP secrets (two-factor authentication is disabled when empty)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  serve                            run the API server (default)\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  gc-tokens                        delete expired tokens and stale login failures once and exit\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  migrate                          up | down [n] | goto <version> | force <version> | status\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  grant-permission <email> <code>  grant a permission no role comes with:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "                                     characters:manage  manage the character catalogue\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "                                     users:manage       unlock locked out accounts\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
 	logger := zerolog.New(os.Stdout)
 
+	config.login.client.Lockout = config.login.account.Lockout
+
+	weights, err := entity.ParseWeights(*gachaWeights)
+	if err != nil {
+		logger.Fatal().
+			Err(err).
+			Msg("invalid gacha weights")
+	}
+	config.gacha.Weights = weights
+
+	if config.gacha.Cost < 1 {
+		logger.Fatal().
+			Int64("gacha-cost", config.gacha.Cost).
+			Msg("gacha cost must be positive")
+	}
+
+	if config.db.queryTimeout <= 0 {
+		logger.Fatal().
+			Dur("db-query-timeout", config.db.queryTimeout).
+			Msg("db query timeout must be positive")
+	}
+
+	isolation := pgx.TxIsoLevel(config.db.isolation)
+	switch isolation {
+	case pgx.ReadCommitted, pgx.RepeatableRead, pgx.Serializable:
+	default:
+		logger.Fatal().
+			Str("db-isolation", config.db.isolation).
+			Msg("unknown transaction isolation level")
+	}
+
+	if config.tokens.gcBatchSize < 1 {
+		logger.Fatal().
+			Int("token-gc-batch-size", config.tokens.gcBatchSize).
+			Msg("token gc batch size must be positive")
+	}
+
 	logger.Info().
 		Str("db-dsn", config.db.dsn).
 		Msg("connecting to the db server")
@@ -45,19 +209,96 @@ func main() {
 			Msgf("error opening db connection")
 	}
 
-	repositories := repository.New(db)
+	repositories := repository.New(db, config.db.queryTimeout, isolation)
+
+	var m mailer.Mailer
+	switch config.mailer.sink {
+	case "smtp":
+		m = mailer.NewSMTP(config.smtp.host, config.smtp.port, config.smtp.username,
+			config.smtp.password, config.smtp.sender)
+	case "file":
+		m = mailer.NewFile(config.mailer.dir, config.smtp.sender)
+	case "stdout":
+		m = mailer.NewFile("", config.smtp.sender)
+	default:
+		logger.Fatal().
+			Str("mailer", config.mailer.sink).
+			Msg("unknown mailer sink")
+	}
+
+	var secrets *secretbox.Box
+	if config.totp.key != "" {
+		key, err := hex.DecodeString(config.totp.key)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("invalid totp key")
+		}
+
+		box, err := secretbox.New(key)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("invalid totp key")
+		}
+		secrets = &box
+	}
 
 	app := application{
-		config:       config,
-		logger:       logger,
-		repositories: repositories,
+		config:        config,
+		logger:        logger,
+		repositories:  repositories,
+		mailer:        m,
+		storage:       storage.NewLocal(config.storage.dir, "/static/"),
+		tokenUsage:    newTokenUsage(),
+		limiter:       newRateLimiter(config.limiter.rps, config.limiter.burst),
+		lookupLimiter: newRateLimiter(config.limiter.lookupRPS, config.limiter.lookupBurst),
+		totp:          totp.New(),
+		secrets:       secrets,
+		wg:            &sync.WaitGroup{},
 	}
 
-	err = app.serve()
-	if err != nil {
-		logger.Fatal().
-			Err(err).
-			Msg("error closing server")
+	switch flag.Arg(0) {
+	case "", "serve":
+		if config.db.autoMigrate {
+			err = app.autoMigrate(db)
+			if err != nil {
+				logger.Fatal().
+					Err(err).
+					Msg("error migrating the database")
+			}
+		}
+
+		err = app.serve()
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("error closing server")
+		}
+	case "gc-tokens":
+		err = app.collectGarbage(nil, config.tokens.gcBatchSize)
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("error collecting garbage")
+		}
+	case "migrate":
+		err = app.migrateCommand(db, flag.Args()[1:])
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("error migrating the database")
+		}
+	case "grant-permission":
+		err = app.grantPermissionCommand(flag.Args()[1:])
+		if err != nil {
+			logger.Fatal().
+				Err(err).
+				Msg("error granting permission")
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
 }
 
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/swsd2544/learny-backend-clone/internal/entity"
 	"github.com/swsd2544/learny-backend-clone/internal/repository"
 	"github.com/swsd2544/learny-backend-clone/internal/validator"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -37,7 +39,7 @@ func (app application) authenticate(next http.Handler) http.Handler {
 
 		headerParts := strings.Split(authorizationHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.rejectTokenResponse(w, r)
 			return
 		}
 
@@ -46,22 +48,69 @@ func (app application) authenticate(next http.Handler) http.Handler {
 		v := validator.New()
 
 		if entity.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.rejectTokenResponse(w, r)
 			return
 		}
 
-		user, err := app.repositories.Users.GetUserWithToken(entity.ScopeAuthentication, token)
+		// The lookup gate is far more generous than the client bucket. It
+		// only keeps a client from making one lookup after another.
+		if app.config.limiter.enabled && !app.lookupLimiter.allow("ip:"+app.clientIP(r)) {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		user, err := app.repositories.Users.GetUserWithToken(r.Context(), entity.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, repository.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				app.rejectTokenResponse(w, r)
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
 
+		tokenHash := sha256.Sum256([]byte(token))
+		app.tokenUsage.touch(tokenHash[:])
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetTokenHash(r, tokenHash[:])
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectTokenResponse answers a request whose bearer token is malformed or
+// unknown. Such a request has no user to be limited by, so it is charged to
+// the bucket of the client IP like an anonymous one.
+func (app application) rejectTokenResponse(w http.ResponseWriter, r *http.Request) {
+	if app.config.limiter.enabled && !app.limiter.allow("ip:"+app.clientIP(r)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
+// rateLimit charges requests of an authenticated user to the bucket of the
+// user and anonymous requests to the bucket of the client IP, so that users
+// sharing an address are limited independently.
+func (app application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + app.clientIP(r)
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			key = "user:" + strconv.FormatInt(user.ID, 10)
+		}
+
+		if !app.limiter.allow(key) {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -79,3 +128,54 @@ func (app application) requiredAuthenticatedUser(next http.HandlerFunc) http.Han
 		next.ServeHTTP(w, r)
 	}
 }
+
+func (app application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requiredAuthenticatedUser(fn)
+}
+
+func (app application) requireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !validator.PermittedValue(user.Role, roles...) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+func (app application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		permissions, err := app.repositories.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
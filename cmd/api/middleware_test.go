@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingUsers counts the token lookups made through it.
+type countingUsers struct {
+	repository.Users
+	lookups int
+}
+
+func (u *countingUsers) GetUserWithToken(ctx context.Context, scope, tokenPlaintext string) (*entity.User, error) {
+	u.lookups++
+	return u.Users.GetUserWithToken(ctx, scope, tokenPlaintext)
+}
+
+func TestRateLimitInvalidTokens(t *testing.T) {
+	app, _, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.burst = 3
+	app.config.limiter.lookupBurst = 5
+	app.limiter = newRateLimiter(0.001, app.config.limiter.burst)
+	app.lookupLimiter = newRateLimiter(0.001, app.config.limiter.lookupBurst)
+
+	users := &countingUsers{Users: app.repositories.Users}
+	app.repositories.Users = users
+
+	routes := app.routes()
+
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("Authorization", "Bearer "+strings.Repeat("A", 26))
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		want := http.StatusUnauthorized
+		if i >= app.config.limiter.burst {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("request %d: got status %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	if users.lookups != app.config.limiter.lookupBurst {
+		t.Fatalf("got %d token lookups, want %d", users.lookups, app.config.limiter.lookupBurst)
+	}
+}
+
+func TestRateLimitUsersBehindOneIP(t *testing.T) {
+	app, _, token := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.burst = 3
+	app.limiter = newRateLimiter(0.001, app.config.limiter.burst)
+	app.lookupLimiter = newRateLimiter(0.001, 100)
+
+	other := &entity.User{Username: "alan", Firstname: "Alan", Lastname: "Turing", Email: "alan@example.com",
+		Role: entity.RoleStudent, Activated: true}
+	other.Password.Hash = []byte("not a real hash")
+
+	err := app.repositories.Users.Insert(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherToken, err := app.repositories.Tokens.New(context.Background(), other.ID, time.Hour, entity.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := app.routes()
+
+	send := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < app.config.limiter.burst; i++ {
+		for _, token := range []string{token, otherToken.Plaintext} {
+			if code := send(token); code != http.StatusOK {
+				t.Fatalf("request %d: got status %d, want %d", i+1, code, http.StatusOK)
+			}
+		}
+	}
+
+	for _, token := range []string{token, otherToken.Plaintext} {
+		if code := send(token); code != http.StatusTooManyRequests {
+			t.Fatalf("got status %d beyond the burst of a user, want %d", code, http.StatusTooManyRequests)
+		}
+	}
+
+	if code := send(""); code != http.StatusUnauthorized {
+		t.Fatalf("got status %d for an anonymous request, want %d from an untouched IP bucket", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/swsd2544/learny-backend-clone/internal/migrate"
+	"github.com/swsd2544/learny-backend-clone/migrations"
+	"strconv"
+)
+
+// migrateCommand runs `migrate up|down [n]|goto <version>|force <version>|status`.
+func (app application) migrateCommand(db *pgxpool.Pool, args []string) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command")
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "goto", "force":
+		if len(args) < 2 {
+			return fmt.Errorf("missing version for migrate %s", args[0])
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		if args[0] == "goto" {
+			err = migrator.Goto(ctx, version)
+		} else {
+			err = migrator.Force(ctx, version)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	return app.logMigrationStatus(ctx, migrator)
+}
+
+// autoMigrate applies pending migrations before the server starts.
+func (app application) autoMigrate(db *pgxpool.Pool) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	return app.logMigrationStatus(ctx, migrator)
+}
+
+func (app application) logMigrationStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]string, len(status.Pending))
+	for i, migration := range status.Pending {
+		pending[i] = fmt.Sprintf("%06d_%s", migration.Version, migration.Name)
+	}
+
+	app.logger.Info().
+		Int64("version", status.Version).
+		Bool("dirty", status.Dirty).
+		Strs("pending", pending).
+		Msg("database migration status")
+
+	return nil
+}
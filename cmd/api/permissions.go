@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"strings"
+)
+
+// grantPermissionCommand runs `grant-permission <email> <code>`. It is the
+// way to hand out the permissions no role comes with, such as
+// characters:manage for the character catalogue and users:manage for
+// unlocking accounts.
+func (app application) grantPermissionCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: grant-permission <email> <code>")
+	}
+
+	email, code := args[0], args[1]
+
+	if !entity.AllPermissions.Include(code) {
+		return fmt.Errorf("unknown permission %q, want one of %s", code, strings.Join(entity.AllPermissions, ", "))
+	}
+
+	ctx := context.Background()
+
+	user, err := app.repositories.Users.GetUserWithEmail(ctx, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			return fmt.Errorf("no user with email %q", email)
+		default:
+			return err
+		}
+	}
+
+	err = app.repositories.Permissions.AddForUser(ctx, user.ID, code)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info().
+		Int64("user_id", user.ID).
+		Str("permission", code).
+		Msg("granted permission")
+
+	return nil
+}
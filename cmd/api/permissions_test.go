@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGrantPermissionCommand(t *testing.T) {
+	app, user, _ := newTestApplication(t)
+
+	for _, args := range [][]string{
+		{},
+		{user.Email},
+		{user.Email, "unknown:code"},
+		{"nobody@example.com", entity.PermissionCharactersManage},
+	} {
+		err := app.grantPermissionCommand(args)
+		if err == nil {
+			t.Fatalf("granting with %q succeeded", args)
+		}
+	}
+
+	err := app.grantPermissionCommand([]string{user.Email, entity.PermissionCharactersManage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, err := app.repositories.Permissions.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !permissions.Include(entity.PermissionCharactersManage) {
+		t.Fatalf("got permissions %v, want characters:manage", permissions)
+	}
+}
+
+func TestGrantUsersManage(t *testing.T) {
+	app, user, token := newTestApplication(t)
+	routes := app.routes()
+
+	unlock := func() int {
+		r := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/users/%d/unlock", user.ID), nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := unlock(); code != http.StatusForbidden {
+		t.Fatalf("got status %d unlocking without users:manage, want %d", code, http.StatusForbidden)
+	}
+
+	err := app.grantPermissionCommand([]string{user.Email, entity.PermissionUsersManage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := unlock(); code != http.StatusOK {
+		t.Fatalf("got status %d unlocking with users:manage, want %d", code, http.StatusOK)
+	}
+}
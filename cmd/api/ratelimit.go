@@ -0,0 +1,66 @@
+package main
+
+import (
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter hands out one token bucket per client key. Buckets of clients
+// that have not been seen for a while are evicted by evict.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   int
+	clients map[string]*client
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rps:     rps,
+		burst:   burst,
+		clients: make(map[string]*client),
+	}
+}
+
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, found := l.clients[key]
+	if !found {
+		c = &client{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.clients[key] = c
+	}
+
+	c.lastSeen = time.Now()
+
+	return c.limiter.Allow()
+}
+
+// evict removes the buckets of clients idle for longer than idle, every
+// interval until done is closed.
+func (l *rateLimiter) evict(done <-chan struct{}, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			for key, c := range l.clients {
+				if time.Since(c.lastSeen) > idle {
+					delete(l.clients, key)
+				}
+			}
+			l.mu.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
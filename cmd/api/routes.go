@@ -2,13 +2,55 @@ package main
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
 	"net/http"
 )
 
 func (app application) routes() http.Handler {
 	r := mux.NewRouter()
-	r.Use(app.recoverPanic, app.authenticate)
+	r.Use(app.recoverPanic, app.authenticate, app.rateLimit)
 	r.HandleFunc("/v1/students", app.registerStudentHandler).Methods(http.MethodPost)
-	r.HandleFunc("/v1/students/login", app.loginStudentHandler).Methods(http.MethodPut)
+	r.HandleFunc("/v1/students/login", app.createAuthenticationTokenHandler).Methods(http.MethodPut)
+	r.HandleFunc("/v1/teachers", app.registerTeacherHandler).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/activated", app.activateUserHandler).Methods(http.MethodPut)
+	r.HandleFunc("/v1/users/{id:[0-9]+}/unlock", app.requirePermission(entity.PermissionUsersManage, app.unlockUserHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/users/password", app.updateUserPasswordHandler).Methods(http.MethodPut)
+	r.HandleFunc("/v1/users/email", app.confirmEmailChangeHandler).Methods(http.MethodPut)
+	r.HandleFunc("/v1/tokens/authentication", app.createAuthenticationTokenHandler).Methods(http.MethodPost)
+	r.HandleFunc("/v1/tokens/authentication", app.requiredAuthenticatedUser(app.deleteAuthenticationTokenHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/tokens/two-factor", app.createTwoFactorTokenHandler).Methods(http.MethodPost)
+	r.HandleFunc("/v1/tokens/refresh", app.refreshAuthenticationTokenHandler).Methods(http.MethodPost)
+	r.HandleFunc("/v1/tokens/password-reset", app.createPasswordResetTokenHandler).Methods(http.MethodPost)
+
+	r.HandleFunc("/v1/classes", app.requirePermission(entity.PermissionClassesRead, app.getClassesHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/classes", app.requirePermission(entity.PermissionClassesWrite, app.createClassHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}", app.requirePermission(entity.PermissionClassesRead, app.showClassHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}", app.requirePermission(entity.PermissionClassesWrite, app.updateClassHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}", app.requirePermission(entity.PermissionClassesWrite, app.deleteClassHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/classes/join", app.requireRole(app.joinClassHandler, entity.RoleStudent)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/enrollment", app.requireRole(app.leaveClassHandler, entity.RoleStudent)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/join-code", app.requirePermission(entity.PermissionClassesWrite, app.rotateJoinCodeHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/students", app.requirePermission(entity.PermissionClassesWrite, app.listClassStudentsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/students", app.requirePermission(entity.PermissionClassesWrite, app.addClassStudentHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/students", app.requirePermission(entity.PermissionClassesWrite, app.removeClassStudentHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/classes/{id:[0-9]+}/students/{student_id:[0-9]+}/coins", app.requirePermission(entity.PermissionCoinsGrant, app.grantCoinsHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/me", app.requiredAuthenticatedUser(app.showCurrentUserHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users/me", app.requiredAuthenticatedUser(app.updateCurrentUserHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/users/me/password", app.requiredAuthenticatedUser(app.changeCurrentUserPasswordHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/users/me/email", app.requireActivatedUser(app.requestEmailChangeHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/me/coins/transactions", app.requireActivatedUser(app.listCoinTransactionsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/characters/draw", app.requireRole(app.drawCharacterHandler, entity.RoleStudent)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/me/characters", app.requireActivatedUser(app.listOwnedCharactersHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users/me/character", app.requireActivatedUser(app.equipCharacterHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/v1/characters", app.requirePermission(entity.PermissionCharactersManage, app.listCharactersHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/characters", app.requirePermission(entity.PermissionCharactersManage, app.createCharacterHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/characters/{id:[0-9]+}", app.requirePermission(entity.PermissionCharactersManage, app.updateCharacterHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/v1/characters/{id:[0-9]+}", app.requirePermission(entity.PermissionCharactersManage, app.retireCharacterHandler)).Methods(http.MethodDelete)
+
+	r.PathPrefix("/static/characters/").Handler(app.serveStatic("characters"))
+	r.HandleFunc("/v1/users/me/sessions", app.requiredAuthenticatedUser(app.listSessionsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users/me/sessions/{id}", app.requiredAuthenticatedUser(app.deleteSessionHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/users/me/2fa", app.requireRole(app.enrollTwoFactorHandler, entity.RoleTeacher)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/me/2fa/confirm", app.requireRole(app.confirmTwoFactorHandler, entity.RoleTeacher)).Methods(http.MethodPost)
 	return r
 }
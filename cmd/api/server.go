@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,16 +13,31 @@ import (
 )
 
 func (app application) serve() error {
+	// Every request context derives from baseCtx, so that requests still
+	// running when the graceful shutdown gives up get their queries canceled.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
 
 	shutdownError := make(chan error)
 
+	// done is closed once the server stops accepting requests, telling the
+	// long-running workers to finish up.
+	done := make(chan struct{})
+
+	app.background(func() { app.flushTokenUsage(done, time.Minute) })
+	app.background(func() { app.limiter.evict(done, time.Minute, 3*time.Minute) })
+	app.background(func() { app.lookupLimiter.evict(done, time.Minute, 3*time.Minute) })
+	app.background(func() { app.runTokenCollector(done, app.config.tokens.gcInterval, app.config.tokens.gcBatchSize) })
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -35,10 +51,18 @@ func (app application) serve() error {
 		defer cancel()
 
 		err := srv.Shutdown(ctx)
+		close(done)
 		if err != nil {
+			cancelRequests()
 			shutdownError <- err
+			return
 		}
 
+		app.logger.Info().
+			Str("addr", srv.Addr).
+			Msg("completing background tasks")
+
+		app.wg.Wait()
 		shutdownError <- nil
 	}()
 
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/subtle"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+)
+
+func (app application) registerTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		registerUserInput
+		InviteCode string `json:"invite_code"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.config.teacherInviteCode == "" {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.InviteCode != "", "invite_code", "must be provided")
+	v.Check(subtle.ConstantTimeCompare([]byte(input.InviteCode), []byte(app.config.teacherInviteCode)) == 1,
+		"invite_code", "is not valid")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.registerUser(w, r, input.registerUserInput, entity.RoleTeacher)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	entity.ValidateEmail(v, input.Email)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	accountKey, clientKey := entity.LoginFailureKeys(input.Email, app.clientIP(r))
+
+	lockedUntil, err := app.repositories.Logins.LockedUntil(r.Context(), accountKey, clientKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		app.lockedOutResponse(w, r, lockedUntil)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			entity.MatchesDummy(input.Password)
+			app.failedLoginResponse(w, r, accountKey, clientKey)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ok, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedLoginResponse(w, r, accountKey, clientKey)
+		return
+	}
+
+	// With two-factor authentication the login only succeeds with the second
+	// factor, and so only then are the failures counted against the account
+	// forgotten.
+	if user.TOTPEnabled {
+		app.createTwoFactorChallenge(w, r, user)
+		return
+	}
+
+	err = app.repositories.Logins.Reset(r.Context(), accountKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	family, err := entity.NewTokenFamily()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.issueTokens(w, r, user, family)
+}
+
+// lockedOutResponse refuses a login attempt made while the account or the
+// client is locked out, telling the client when to try again.
+func (app application) lockedOutResponse(w http.ResponseWriter, r *http.Request, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	app.rateLimitExceededResponse(w, r)
+}
+
+// failedLoginResponse counts the failed login against both the account and
+// the client before answering with invalid credentials.
+func (app application) failedLoginResponse(w http.ResponseWriter, r *http.Request, accountKey, clientKey string) {
+	err := app.repositories.Logins.Record(r.Context(), accountKey, app.config.login.account)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.repositories.Logins.Record(r.Context(), clientKey, app.config.login.client)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.invalidCredentialsResponse(w, r)
+}
+
+func (app application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.repositories.Tokens.Rotate(r.Context(), input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, repository.ErrTokenReused):
+			// A rotated refresh token was presented again, so it has leaked to
+			// someone. Revoke everything issued from it, for both parties.
+			app.logger.Warn().
+				Int64("user_id", token.UserID).
+				Msg("refresh token reused, revoking token family")
+
+			err = app.repositories.Tokens.DeleteFamily(r.Context(), token.Family)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithID(r.Context(), token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.issueTokens(w, r, user, token.Family)
+}
+
+// issueTokens creates an authentication token and a refresh token in the
+// given family and writes both to the response.
+func (app application) issueTokens(w http.ResponseWriter, r *http.Request, user *entity.User, family string) {
+	token, err := app.newSessionToken(r, user.ID, app.config.tokens.authenticationTTL, entity.ScopeAuthentication, family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	refreshToken, err := app.newSessionToken(r, user.ID, app.config.tokens.refreshTTL, entity.ScopeRefresh, family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"token": *token, "refresh_token": *refreshToken, "role": user.Role}
+
+	err = writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) newSessionToken(r *http.Request, userID int64, ttl time.Duration, scope, family string) (*entity.Token, error) {
+	token, err := entity.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.UserAgent = r.UserAgent()
+	token.IP = app.clientIP(r)
+
+	err = app.repositories.Tokens.Insert(r.Context(), token)
+	return token, err
+}
+
+func (app application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The answer is the same whether or not the address belongs to an
+	// activated account, and the token is created in the background, so that
+	// neither the answer nor its timing tells the two apart.
+	if err == nil && user.Activated {
+		app.background(func() {
+			token, err := app.repositories.Tokens.New(context.Background(), user.ID, 45*time.Minute, entity.ScopePasswordReset)
+			if err != nil {
+				app.logger.Error().
+					Err(err).
+					Int64("user_id", user.ID).
+					Msg("error creating password reset token")
+				return
+			}
+
+			data := map[string]any{
+				"passwordResetToken": token.Plaintext,
+			}
+
+			err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				app.logger.Error().
+					Err(err).
+					Int64("user_id", user.ID).
+					Msg("error sending password reset email")
+			}
+		})
+	}
+
+	env := envelope{"message": "if an activated account uses this address, an email will be sent to it containing password reset instructions"}
+
+	err = writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.repositories.Tokens.DeleteFamilyOfHash(r.Context(), app.contextGetTokenHash(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.repositories.Tokens.GetSessionsForUser(r.Context(), user.ID, app.contextGetTokenHash(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.repositories.Tokens.DeleteSessionForUser(r.Context(), user.ID, mux.Vars(r)["id"])
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	app, _, _ := newTestApplication(t)
+	mailer := testMailer{sent: make(chan map[string]any, 3)}
+	app.mailer = mailer
+	routes := app.routes()
+
+	inactive := &entity.User{Username: "alan", Firstname: "Alan", Lastname: "Turing", Email: "alan@example.com",
+		Role: entity.RoleStudent}
+	inactive.Password.Hash = []byte("not a real hash")
+
+	err := app.repositories.Users.Insert(context.Background(), inactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies []string
+	for _, email := range []string{"nobody@example.com", "alan@example.com", "ada@example.com"} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/tokens/password-reset", strings.NewReader(`{"email": "`+email+`"}`))
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("got status %d for %s, want %d", w.Code, email, http.StatusAccepted)
+		}
+		bodies = append(bodies, w.Body.String())
+	}
+
+	if bodies[0] != bodies[1] || bodies[1] != bodies[2] {
+		t.Fatalf("got different answers for unknown, inactive and activated accounts: %q", bodies)
+	}
+
+	app.wg.Wait()
+
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want one to the activated account", len(mailer.sent))
+	}
+	data := <-mailer.sent
+	if token, _ := data["passwordResetToken"].(string); len(token) != 26 {
+		t.Fatalf("got password reset token %q", token)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/totp"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app application) twoFactorNotConfiguredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is not available on this server"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if app.secrets == nil {
+		app.twoFactorNotConfiguredResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sealedSecret, err := app.secrets.Seal([]byte(secret))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.repositories.TwoFactor.SetPendingSecret(r.Context(), user.ID, sealedSecret)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"secret":      secret,
+		"otpauth_uri": app.totp.URI("Learny", user.Email, secret),
+	}
+
+	err = writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if app.secrets == nil {
+		app.twoFactorNotConfiguredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	sealedSecret, enabled, err := app.repositories.TwoFactor.GetSecret(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if enabled {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	ok, err := app.verifyTOTP(r.Context(), user.ID, sealedSecret, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := entity.GenerateRecoveryCodes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = entity.HashRecoveryCode(code)
+	}
+
+	err = app.repositories.TwoFactor.Enable(r.Context(), user.ID, hashes)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTwoFactorTokenHandler completes a login for a user with two-factor
+// authentication: the challenge token handed out by
+// createAuthenticationTokenHandler is exchanged, together with a TOTP code
+// or a recovery code, for the real authentication tokens.
+func (app application) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if app.secrets == nil {
+		app.twoFactorNotConfiguredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	entity.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if input.RecoveryCode == "" {
+		entity.ValidateTOTPCode(v, input.Code)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithToken(r.Context(), entity.ScopeTwoFactor, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	accountKey, clientKey := entity.LoginFailureKeys(user.Email, app.clientIP(r))
+
+	lockedUntil, err := app.repositories.Logins.LockedUntil(r.Context(), accountKey, clientKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		app.lockedOutResponse(w, r, lockedUntil)
+		return
+	}
+
+	var ok bool
+	if input.RecoveryCode != "" {
+		ok, err = app.repositories.TwoFactor.UseRecoveryCode(r.Context(), user.ID, entity.HashRecoveryCode(input.RecoveryCode))
+	} else {
+		var sealedSecret []byte
+		sealedSecret, _, err = app.repositories.TwoFactor.GetSecret(r.Context(), user.ID)
+		if err == nil {
+			ok, err = app.verifyTOTP(r.Context(), user.ID, sealedSecret, input.Code)
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedLoginResponse(w, r, accountKey, clientKey)
+		return
+	}
+
+	err = app.repositories.Tokens.DeleteAllForUser(r.Context(), entity.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.repositories.Logins.Reset(r.Context(), accountKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	family, err := entity.NewTokenFamily()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.issueTokens(w, r, user, family)
+}
+
+// createTwoFactorChallenge answers a correct password for a user with
+// two-factor authentication enabled: instead of authentication tokens the
+// client gets a short-lived token to present along with the TOTP code.
+func (app application) createTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *entity.User) {
+	token, err := app.repositories.Tokens.New(r.Context(), user.ID, 5*time.Minute, entity.ScopeTwoFactor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"two_factor_required": true, "two_factor_token": *token}
+
+	err = writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyTOTP decrypts the user's secret and checks the code against it. A
+// code is accepted only once, even within its validity window.
+func (app application) verifyTOTP(ctx context.Context, userID int64, sealedSecret []byte, code string) (bool, error) {
+	secret, err := app.secrets.Open(sealedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok, err := app.totp.Validate(string(secret), code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return app.repositories.TwoFactor.UseStep(ctx, userID, step)
+}
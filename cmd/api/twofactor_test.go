@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/secretbox"
+	"github.com/swsd2544/learny-backend-clone/internal/totp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTwoFactorLogin walks through enrolling in two-factor authentication
+// and the two-step login that follows, with the TOTP clock under the test's
+// control.
+func TestTwoFactorLogin(t *testing.T) {
+	app, user, token := newTestApplication(t)
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.repositories.Users.Update(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	app.totp = totp.New()
+	app.totp.Now = func() time.Time { return now }
+
+	box, err := secretbox.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.secrets = &box
+
+	routes := app.routes()
+
+	send := func(path, token string, body any) (*httptest.ResponseRecorder, map[string]any) {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(js)))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+
+		var response map[string]any
+		err = json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("decoding the response to %s: %v", path, err)
+		}
+		return w, response
+	}
+
+	code := func(secret string) string {
+		c, err := app.totp.Code(secret, app.totp.Step(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	w, response := send("/v1/users/me/2fa", token, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d enrolling, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	secret, _ := response["secret"].(string)
+
+	w, _ = send("/v1/users/me/2fa/confirm", token, map[string]string{"code": code(secret)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d confirming, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	login := func() string {
+		t.Helper()
+
+		w, response := send("/v1/tokens/authentication", "", map[string]string{"email": user.Email, "password": "pa55word"})
+		if w.Code != http.StatusAccepted || response["two_factor_required"] != true {
+			t.Fatalf("got status %d logging in, want a two-factor challenge: %s", w.Code, w.Body)
+		}
+		if _, ok := response["token"]; ok {
+			t.Fatal("got an authentication token before the second factor")
+		}
+
+		challenge, _ := response["two_factor_token"].(map[string]any)
+		plaintext, _ := challenge["token"].(string)
+		return plaintext
+	}
+
+	now = now.Add(30 * time.Second)
+	current := code(secret)
+
+	w, response = send("/v1/tokens/two-factor", "", map[string]string{"token": login(), "code": current})
+	if w.Code != http.StatusCreated || response["token"] == nil {
+		t.Fatalf("got status %d exchanging the code, want %d with tokens: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	w, _ = send("/v1/tokens/two-factor", "", map[string]string{"token": login(), "code": current})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d replaying the code, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+}
+
+// TestTwoFactorLockout checks that entering the right password again does
+// not clear the failed second factors counted against the account.
+func TestTwoFactorLockout(t *testing.T) {
+	app, user, _ := newTestApplication(t)
+	ctx := context.Background()
+
+	app.config.login.account = entity.LoginPolicy{FreeAttempts: 2, MaxAttempts: 3, BaseDelay: time.Minute,
+		Lockout: time.Hour, Window: time.Hour}
+	app.config.login.client = entity.LoginPolicy{FreeAttempts: 100, MaxAttempts: 1000, BaseDelay: time.Minute,
+		Lockout: time.Hour, Window: time.Hour}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.repositories.Users.Update(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.totp = totp.New()
+
+	box, err := secretbox.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.secrets = &box
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedSecret, err := box.Seal([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.repositories.TwoFactor.SetPendingSecret(ctx, user.ID, sealedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.repositories.TwoFactor.Enable(ctx, user.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A code the secret produces for none of the steps accepted now.
+	accepted := make(map[string]bool)
+	for step := app.totp.Step(time.Now()) - 2; step <= app.totp.Step(time.Now())+2; step++ {
+		code, err := app.totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted[code] = true
+	}
+	var wrong string
+	for digit := 0; wrong == "" || accepted[wrong]; digit++ {
+		wrong = strings.Repeat(fmt.Sprint(digit), 6)
+	}
+
+	routes := app.routes()
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w
+	}
+
+	login := `{"email": "` + user.Email + `", "password": "pa55word"}`
+
+	for i := 0; i < 3; i++ {
+		w := send("/v1/tokens/authentication", login)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("attempt %d: got status %d logging in, want %d: %s", i+1, w.Code, http.StatusAccepted, w.Body)
+		}
+
+		var response struct {
+			Token struct {
+				Plaintext string `json:"token"`
+			} `json:"two_factor_token"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w = send("/v1/tokens/two-factor", `{"token": "`+response.Token.Plaintext+`", "code": "`+wrong+`"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %d for a wrong code, want %d", i+1, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	w := send("/v1/tokens/authentication", login)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d logging in after three wrong codes, want the account locked with %d", w.Code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenUsage collects the last time each authentication token was used so
+// that last_used_at can be written in periodic batches instead of with an
+// UPDATE on every request.
+type tokenUsage struct {
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+func newTokenUsage() *tokenUsage {
+	return &tokenUsage{lastUsed: make(map[string]time.Time)}
+}
+
+func (u *tokenUsage) touch(hash []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastUsed[string(hash)] = time.Now()
+}
+
+// drain returns the collected usage and starts a new batch.
+func (u *tokenUsage) drain() map[string]time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	lastUsed := u.lastUsed
+	u.lastUsed = make(map[string]time.Time)
+	return lastUsed
+}
+
+// flushTokenUsage writes the collected token usage to the database every
+// interval until done is closed, then writes whatever is left one last time.
+func (app application) flushTokenUsage(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		lastUsed := app.tokenUsage.drain()
+		if len(lastUsed) == 0 {
+			return
+		}
+
+		err := app.repositories.Tokens.TouchLastUsed(context.Background(), lastUsed)
+		if err != nil {
+			app.logger.Error().
+				Err(err).
+				Int("tokens", len(lastUsed)).
+				Msg("error recording token usage")
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case <-done:
+			flush()
+			return
+		}
+	}
+}
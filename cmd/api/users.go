@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"net/http"
+	"time"
+)
+
+type registerUserInput struct {
+	Username  string `json:"username"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+}
+
+func (app application) registerUser(w http.ResponseWriter, r *http.Request, input registerUserInput, role string) {
+	user := &entity.User{
+		Username:    input.Username,
+		Firstname:   input.Firstname,
+		Lastname:    input.Lastname,
+		Email:       input.Email,
+		Coin:        0,
+		Role:        role,
+		CharacterID: entity.DefaultCharacterID,
+	}
+	err := user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The account only exists together with its permissions, starting
+	// character and activation token.
+	var token *entity.Token
+	err = app.repositories.Transactor.WithinTx(r.Context(), func(tx repository.Repositories) error {
+		err := tx.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Permissions.AddForUser(r.Context(), user.ID, entity.DefaultPermissions(role)...)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Characters.AddForUser(r.Context(), user.ID, user.CharacterID)
+		if err != nil {
+			return err
+		}
+
+		token, err = tx.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, entity.ScopeActivation)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+			"firstname":       user.Firstname,
+			"userID":          user.ID,
+		}
+
+		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.logger.Error().
+				Err(err).
+				Int64("user_id", user.ID).
+				Msg("error sending welcome email")
+		}
+	})
+
+	err = writeJSON(w, http.StatusCreated, envelope{"user": *user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if entity.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithToken(r.Context(), entity.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = app.updateUserWithinTx(r.Context(), user, func(tx repository.Repositories) error {
+		return tx.Tokens.DeleteAllForUser(r.Context(), entity.ScopeActivation, user.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"user": *user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	entity.ValidatePassword(v, input.Password)
+	entity.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithToken(r.Context(), entity.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.updateUserWithinTx(r.Context(), user, func(tx repository.Repositories) error {
+		for _, scope := range []string{entity.ScopePasswordReset, entity.ScopeAuthentication, entity.ScopeRefresh} {
+			err := tx.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"message": "your password was successfully reset"}
+
+	err = writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockUserHandler lifts the lockout of an account. It needs users:manage,
+// which is granted with the grant-permission command.
+func (app application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.repositories.Users.GetUserWithID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	accountKey, _ := entity.LoginFailureKeys(user.Email, "")
+
+	err = app.repositories.Logins.Reset(r.Context(), accountKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"message": "the account was successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := writeJSON(w, http.StatusOK, envelope{"user": *user}, versionHeaders(user.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	expectedVersion, ok, err := readExpectedVersion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if ok && expectedVersion != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Username  *string `json:"username"`
+		Firstname *string `json:"firstname"`
+		Lastname  *string `json:"lastname"`
+	}
+	err = readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Username != nil {
+		user.Username = *input.Username
+	}
+	if input.Firstname != nil {
+		user.Firstname = *input.Firstname
+	}
+	if input.Lastname != nil {
+		user.Lastname = *input.Lastname
+	}
+
+	v := validator.New()
+	if entity.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.repositories.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = writeJSON(w, http.StatusOK, envelope{"user": *user}, versionHeaders(user.Version))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// changeCurrentUserPasswordHandler changes the password of a signed in user.
+// Unlike a reset it requires the current password, and it keeps the session
+// the change was made from while signing out every other one.
+func (app application) changeCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	err := readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	entity.ValidatePassword(v, input.NewPassword)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	match, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.NewPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.updateUserWithinTx(r.Context(), user, func(tx repository.Repositories) error {
+		err := tx.Tokens.DeleteAllForUser(r.Context(), entity.ScopePasswordReset, user.ID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.DeleteOtherSessions(r.Context(), user.ID, app.contextGetTokenHash(r))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"message": "your password was successfully changed"}
+
+	err = writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserWithinTx updates the user and runs fn in the same transaction.
+// The transaction may be retried, so the version the update checks against
+// is restored before every attempt.
+func (app application) updateUserWithinTx(ctx context.Context, user *entity.User, fn func(tx repository.Repositories) error) error {
+	version := user.Version
+
+	return app.repositories.Transactor.WithinTx(ctx, func(tx repository.Repositories) error {
+		user.Version = version
+
+		err := tx.Users.Update(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
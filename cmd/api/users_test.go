@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository/memory"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestApplication returns an application backed by the in-memory
+// repositories, with a signed in user and that user's authentication token.
+func newTestApplication(t *testing.T) (application, *entity.User, string) {
+	t.Helper()
+
+	app := application{
+		logger:       zerolog.Nop(),
+		repositories: memory.New(),
+		tokenUsage:   newTokenUsage(),
+		wg:           &sync.WaitGroup{},
+	}
+
+	user := &entity.User{
+		Username:  "ada",
+		Firstname: "Ada",
+		Lastname:  "Lovelace",
+		Email:     "ada@example.com",
+		Role:      entity.RoleTeacher,
+		Activated: true,
+	}
+	user.Password.Hash = []byte("not a real hash")
+
+	err := app.repositories.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.repositories.Tokens.New(context.Background(), user.ID, time.Hour, entity.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return app, user, token.Plaintext
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	app, _, token := newTestApplication(t)
+	routes := app.routes()
+
+	send := func(method, body string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v1/users/me", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(http.MethodGet, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d showing the user, want %d", w.Code, http.StatusOK)
+	}
+	etag := w.Header().Get("ETag")
+
+	w = send(http.MethodPatch, `{"firstname": "Augusta"}`, map[string]string{"If-Match": etag})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d updating the user, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var response struct {
+		User entity.User `json:"user"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.User.Firstname != "Augusta" || response.User.Lastname != "Lovelace" {
+		t.Fatalf("got %s %s, want Augusta Lovelace", response.User.Firstname, response.User.Lastname)
+	}
+
+	w = send(http.MethodPatch, `{"lastname": "King"}`, map[string]string{"If-Match": etag})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d updating with a stale version, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = send(http.MethodPatch, `{"lastname": "King"}`, map[string]string{"X-Expected-Version": "2"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d updating with X-Expected-Version, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// testMailer hands the data of every email sent through it to the test.
+type testMailer struct {
+	sent chan map[string]any
+}
+
+func (m testMailer) Send(recipient, templateFile string, data any) error {
+	m.sent <- data.(map[string]any)
+	return nil
+}
+
+func TestRegisterAndActivate(t *testing.T) {
+	app, _, _ := newTestApplication(t)
+	mailer := testMailer{sent: make(chan map[string]any, 1)}
+	app.mailer = mailer
+	routes := app.routes()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, r)
+		return w
+	}
+
+	body := `{"username": "grace", "firstname": "Grace", "lastname": "Hopper",
+		"email": "grace@example.com", "password": "Correct-Horse-Battery-9"}`
+
+	w := send(http.MethodPost, "/v1/students", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d registering, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var data map[string]any
+	select {
+	case data = <-mailer.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no welcome email was sent")
+	}
+
+	w = send(http.MethodPost, "/v1/students", body)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d registering twice, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	token, _ := data["activationToken"].(string)
+	w = send(http.MethodPut, "/v1/users/activated", `{"token": "`+token+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d activating, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	w = send(http.MethodPut, "/v1/users/activated", `{"token": "`+token+`"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d reusing the activation token, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	user, err := app.repositories.Users.GetUserWithEmail(context.Background(), "grace@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Activated {
+		t.Fatal("the user is not activated")
+	}
+
+	permissions, err := app.repositories.Permissions.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !permissions.Include(entity.PermissionClassesRead) {
+		t.Fatalf("got permissions %v, want classes:read", permissions)
+	}
+}
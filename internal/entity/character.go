@@ -1,6 +1,9 @@
 package entity
 
-import "time"
+import (
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"time"
+)
 
 const (
 	COMMON    = "common"
@@ -12,7 +15,25 @@ const (
 type Character struct {
 	ID        int64     `json:"id"`
 	ImageURL  string    `json:"image_url"`
-	Rarity    string    `json:"string"`
+	Rarity    string    `json:"rarity"`
+	Retired   bool      `json:"retired"`
 	CreatedAt time.Time `json:"created_at"`
 	Version   int64     `json:"-"`
 }
+
+// DefaultCharacterID is the character every user starts with. It can never be
+// retired.
+const DefaultCharacterID = 1
+
+func ValidateCharacter(v *validator.Validator, character *Character) {
+	v.Check(validator.PermittedValue(character.Rarity, Rarities...), "rarity", "must be either common, rare, legendary or mystic")
+	v.Check(!character.Retired || character.ID != DefaultCharacterID, "retired", "the default character cannot be retired")
+}
+
+// OwnedCharacter is a character in a user's collection. Count is how many
+// times the user obtained it, duplicates included.
+type OwnedCharacter struct {
+	Character
+	Count      int64     `json:"count"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
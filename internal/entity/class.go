@@ -1,6 +1,10 @@
 package entity
 
-import "time"
+import (
+	"crypto/rand"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"time"
+)
 
 type Class struct {
 	ID          int64     `json:"id"`
@@ -10,3 +14,34 @@ type Class struct {
 	CreatedAt   time.Time `json:"created_at"`
 	Version     int64     `json:"-"`
 }
+
+func ValidateClass(v *validator.Validator, class *Class) {
+	v.Check(class.Name != "", "name", "must be provided")
+	v.Check(len(class.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(class.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+const joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateJoinCode returns a random 8 character code students use to join a
+// class. The alphabet leaves out characters that are easily confused when
+// read aloud or copied from a whiteboard.
+func GenerateJoinCode() (string, error) {
+	randomBytes := make([]byte, 8)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range randomBytes {
+		randomBytes[i] = joinCodeAlphabet[int(randomBytes[i])%len(joinCodeAlphabet)]
+	}
+
+	return string(randomBytes), nil
+}
+
+func ValidateJoinCode(v *validator.Validator, code string) {
+	v.Check(code != "", "join_code", "must be provided")
+	v.Check(len(code) == 8, "join_code", "must be 8 characters long")
+}
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"time"
+)
+
+// CoinTransaction is one entry of the append-only coin ledger. A user's coin
+// balance only ever changes together with the insertion of one of these.
+type CoinTransaction struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Delta          int64     `json:"delta"`
+	Reason         string    `json:"reason"`
+	ActorID        *int64    `json:"actor_id,omitempty"`
+	ClassID        *int64    `json:"class_id,omitempty"`
+	IdempotencyKey string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func ValidateCoinTransaction(v *validator.Validator, transaction *CoinTransaction) {
+	v.Check(transaction.Delta != 0, "delta", "must not be zero")
+	v.Check(transaction.Delta <= 1_000_000, "delta", "must not be more than 1000000")
+	v.Check(transaction.Delta >= -1_000_000, "delta", "must not be less than -1000000")
+	v.Check(transaction.Reason != "", "reason", "must be provided")
+	v.Check(len(transaction.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	v.Check(len(transaction.IdempotencyKey) <= 255, "idempotency_key", "must not be more than 255 bytes long")
+}
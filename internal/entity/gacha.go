@@ -0,0 +1,106 @@
+package entity
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Rarities lists every character rarity from the most to the least common.
+var Rarities = []string{COMMON, RARE, LEGENDARY, MYSTIC}
+
+var ErrNoCharacters = errors.New("no characters available")
+
+// Banner holds the rules of a gacha draw. Weights are relative, so
+// {common: 70, rare: 30} gives a rare 30% of the time. After Pity draws in a
+// row without a legendary or better, the next draw is guaranteed to be one.
+type Banner struct {
+	Cost    int64
+	Weights map[string]int
+	Pity    int
+}
+
+// ParseWeights parses weights written as "common:70,rare:25,legendary:4,mystic:1".
+func ParseWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+
+	for _, pair := range strings.Split(s, ",") {
+		rarity, weight, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rarity weight %q", pair)
+		}
+
+		if !validator.PermittedValue(rarity, Rarities...) {
+			return nil, fmt.Errorf("unknown rarity %q", rarity)
+		}
+
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight for rarity %q", rarity)
+		}
+
+		weights[rarity] = w
+	}
+
+	return weights, nil
+}
+
+// IsRare reports whether drawing rarity resets the pity counter.
+func IsRare(rarity string) bool {
+	return rarity == LEGENDARY || rarity == MYSTIC
+}
+
+// PickRarity picks a rarity among the available ones using the banner
+// weights. pity is the number of draws since the user last drew a rare
+// character.
+func (b Banner) PickRarity(pity int, available []string) (string, error) {
+	guaranteed := b.Pity > 0 && pity+1 >= b.Pity
+
+	var candidates []string
+	total := 0
+	for _, rarity := range Rarities {
+		if !validator.PermittedValue(rarity, available...) || b.Weights[rarity] <= 0 {
+			continue
+		}
+		if guaranteed && !IsRare(rarity) {
+			continue
+		}
+		candidates = append(candidates, rarity)
+		total += b.Weights[rarity]
+	}
+
+	if len(candidates) == 0 {
+		if guaranteed {
+			return b.PickRarity(-1, available)
+		}
+		return "", ErrNoCharacters
+	}
+
+	n, err := RandomInt(total)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rarity := range candidates {
+		n -= b.Weights[rarity]
+		if n < 0 {
+			return rarity, nil
+		}
+	}
+
+	return candidates[len(candidates)-1], nil
+}
+
+// RandomInt returns a uniformly distributed integer in [0, n) read from
+// crypto/rand.
+func RandomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
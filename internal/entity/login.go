@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// LoginPolicy decides how long logins are blocked after repeated failures.
+// The first FreeAttempts failures cost nothing, each following one doubles
+// the wait starting from BaseDelay, and from MaxAttempts failures on the key
+// is locked out for Lockout. Failures older than Window are forgotten.
+type LoginPolicy struct {
+	FreeAttempts int
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// LockedUntil returns when the next login may be attempted after the given
+// number of consecutive failures, the last of which happened at now.
+func (p LoginPolicy) LockedUntil(failures int, now time.Time) time.Time {
+	if failures <= p.FreeAttempts {
+		return now
+	}
+
+	if failures >= p.MaxAttempts {
+		return now.Add(p.Lockout)
+	}
+
+	delay := p.BaseDelay << (failures - p.FreeAttempts - 1)
+	if delay <= 0 || delay > p.Lockout {
+		delay = p.Lockout
+	}
+
+	return now.Add(delay)
+}
+
+// LoginFailureKeys returns the keys failed logins are tracked under: one for
+// the account and one for the client address.
+func LoginFailureKeys(email, ip string) (account, client string) {
+	return "email:" + strings.ToLower(email), "ip:" + ip
+}
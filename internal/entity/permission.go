@@ -0,0 +1,44 @@
+package entity
+
+const (
+	PermissionClassesRead      = "classes:read"
+	PermissionClassesWrite     = "classes:write"
+	PermissionCoinsGrant       = "coins:grant"
+	PermissionCharactersManage = "characters:manage"
+	PermissionUsersManage      = "users:manage"
+)
+
+type Permissions []string
+
+// AllPermissions lists every permission code there is, as held by the
+// permissions table.
+var AllPermissions = Permissions{
+	PermissionClassesRead,
+	PermissionClassesWrite,
+	PermissionCoinsGrant,
+	PermissionCharactersManage,
+	PermissionUsersManage,
+}
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPermissions returns the permissions granted to a newly registered
+// user with the given role. Anything beyond these, such as characters:manage
+// and users:manage, is granted with the grant-permission command.
+func DefaultPermissions(role string) Permissions {
+	switch role {
+	case RoleTeacher:
+		return Permissions{PermissionClassesRead, PermissionClassesWrite, PermissionCoinsGrant}
+	case RoleStudent:
+		return Permissions{PermissionClassesRead}
+	default:
+		return Permissions{}
+	}
+}
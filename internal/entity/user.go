@@ -5,6 +5,7 @@ import (
 	"github.com/swsd2544/learny-backend-clone/internal/validator"
 	passwordvalidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
 	"time"
 )
 
@@ -31,6 +32,8 @@ type User struct {
 	Password    password  `json:"-"`
 	Coin        int64     `json:"coin"`
 	Role        string    `json:"role"`
+	Activated   bool      `json:"activated"`
+	TOTPEnabled bool      `json:"totp_enabled"`
 	CreatedAt   time.Time `json:"created_at"`
 	Version     int64     `json:"-"`
 	CharacterID int64     `json:"character_id"`
@@ -68,6 +71,22 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// MatchesDummy spends the same time as password.Matches without comparing
+// against any real account, so that a login for an unknown email address
+// takes as long as one with a wrong password.
+func MatchesDummy(plaintextPassword string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("learny-dummy-password"), SALT)
+	})
+
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(plaintextPassword))
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
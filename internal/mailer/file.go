@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer is a development sink which never talks to a mail server. When
+// dir is empty every message is written to stdout, otherwise each message is
+// stored as an .eml file inside dir.
+type FileMailer struct {
+	dir    string
+	sender string
+	out    io.Writer
+	mu     *sync.Mutex
+}
+
+func NewFile(dir, sender string) FileMailer {
+	return FileMailer{
+		dir:    dir,
+		sender: sender,
+		out:    os.Stdout,
+		mu:     &sync.Mutex{},
+	}
+}
+
+func (m FileMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dir == "" {
+		_, err = m.out.Write(append(body, '\n'))
+		return err
+	}
+
+	err = os.MkdirAll(m.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s-%s.eml", time.Now().UnixNano(),
+		strings.TrimSuffix(templateFile, filepath.Ext(templateFile)), sanitize(recipient))
+
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o644)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends an email rendered from one of the embedded templates. Every
+// template defines a "subject", a "plainBody" and an "htmlBody" block.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+type message struct {
+	sender    string
+	recipient string
+	subject   string
+	plainBody string
+	htmlBody  string
+}
+
+func render(sender, recipient, templateFile string, data any) (*message, error) {
+	path := "templates/" + templateFile
+
+	textTmpl, err := texttemplate.New("email").ParseFS(templateFS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &message{
+		sender:    sender,
+		recipient: recipient,
+		subject:   strings.TrimSpace(subject.String()),
+		plainBody: plainBody.String(),
+		htmlBody:  htmlBody.String(),
+	}
+
+	return msg, nil
+}
+
+// bytes encodes the message as a multipart/alternative MIME document ready
+// to be handed to an SMTP server or written to disk.
+func (m *message) bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s\r\n", m.sender)
+	fmt.Fprintf(buf, "To: %s\r\n", m.recipient)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", m.plainBody},
+		{"text/html; charset=utf-8", m.htmlBody},
+	}
+
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "8bit")
+
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = w.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
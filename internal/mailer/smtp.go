@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type SMTPMailer struct {
+	host    string
+	addr    string
+	auth    smtp.Auth
+	sender  string
+	timeout time.Duration
+}
+
+func NewSMTP(host string, port int, username, password, sender string) SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return SMTPMailer{
+		host:    host,
+		addr:    fmt.Sprintf("%s:%d", host, port),
+		auth:    auth,
+		sender:  sender,
+		timeout: 10 * time.Second,
+	}
+}
+
+func (m SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = m.send(from.Address, recipient, body)
+		if err == nil {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return err
+}
+
+// send delivers one message the way smtp.SendMail does, except that the
+// whole conversation with the server has to finish within m.timeout, so a
+// server that stops answering cannot hold up the caller.
+func (m SMTPMailer) send(from, recipient string, body []byte) error {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(m.timeout))
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			err = c.Auth(m.auth)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+
+	err = c.Rcpt(recipient)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
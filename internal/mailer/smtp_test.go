@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen starts a server on a free local port that hands every connection
+// to serve, and returns a mailer pointing at it.
+func listen(t *testing.T, serve func(conn net.Conn)) SMTPMailer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	m := NewSMTP("127.0.0.1", l.Addr().(*net.TCPAddr).Port, "", "", "Learny <no-reply@example.com>")
+	m.timeout = 100 * time.Millisecond
+	return m
+}
+
+var data = map[string]any{"activationToken": "TOKEN", "firstname": "Ada", "userID": 1}
+
+func TestSMTPSend(t *testing.T) {
+	received := make(chan string, 1)
+
+	m := listen(t, func(conn net.Conn) {
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost")
+		var message strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				received <- message.String()
+				reply("250 ok")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	})
+
+	err := m.Send("ada@example.com", "user_welcome.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-received
+	if !strings.Contains(message, "To: ada@example.com") {
+		t.Fatalf("got message %q, want one to ada@example.com", message)
+	}
+}
+
+func TestSMTPSendTimeout(t *testing.T) {
+	m := listen(t, func(conn net.Conn) {
+		// Read whatever comes until the client gives up, never answering.
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	})
+
+	start := time.Now()
+
+	err := m.Send("ada@example.com", "user_welcome.tmpl", data)
+	if err == nil {
+		t.Fatal("sending to a server that never answers succeeded")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up after %v, want the timeout to cut every attempt short", elapsed)
+	}
+}
@@ -0,0 +1,317 @@
+// Package migrate applies golang-migrate style SQL migrations
+// (NNNNNN_name.up.sql / NNNNNN_name.down.sql) to Postgres. The applied version
+// is kept in the same schema_migrations table golang-migrate uses, so
+// databases migrated by hand with its CLI can be taken over as they are.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockID is the key of the Postgres advisory lock held while migrating, so
+// that several instances started at once do not migrate concurrently.
+const lockID int64 = 0x6c6561726e79
+
+var (
+	ErrDirty          = errors.New("database is dirty")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+var fileRX = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status describes the state of the database. Dirty means the migration at
+// Version failed half-way, in either direction, and has to be repaired by
+// hand before Force marks the database clean again.
+type Status struct {
+	Version int64
+	Dirty   bool
+	Pending []Migration
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+// New reads the migrations from the root of fsys.
+func New(db *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("conflicting names for migration %d", version)
+		}
+
+		if matches[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.migrate(ctx, func(current int) (int, error) {
+		return len(m.migrations) - 1, nil
+	})
+}
+
+// Down rolls back the given number of the most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.migrate(ctx, func(current int) (int, error) {
+		target := current - steps
+		if target < -1 {
+			target = -1
+		}
+		return target, nil
+	})
+}
+
+// Goto migrates up or down to the given version, 0 meaning an empty database.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	return m.migrate(ctx, func(current int) (int, error) {
+		return m.index(version)
+	})
+}
+
+// Force records the given version as applied and clean without running any
+// migration, for recovering from a dirty state after a manual repair.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	_, err := m.index(version)
+	if err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := getVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		status.Version = version
+		status.Dirty = dirty
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				status.Pending = append(status.Pending, migration)
+			}
+		}
+
+		return nil
+	})
+
+	return status, err
+}
+
+// index returns the position of the migration with the given version, -1
+// standing for version 0.
+func (m *Migrator) index(version int64) (int, error) {
+	if version == 0 {
+		return -1, nil
+	}
+
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+}
+
+// migrate moves the database from the current migration to the one picked
+// by target, both given as positions in m.migrations.
+func (m *Migrator) migrate(ctx context.Context, target func(current int) (int, error)) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := getVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w: migration %d did not complete", ErrDirty, version)
+		}
+
+		current, err := m.index(version)
+		if err != nil {
+			return err
+		}
+
+		to, err := target(current)
+		if err != nil {
+			return err
+		}
+
+		for i := current + 1; i <= to; i++ {
+			migration := m.migrations[i]
+
+			err = run(ctx, conn, migration.Version, migration.up, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		for i := current; i > to; i-- {
+			migration := m.migrations[i]
+			if migration.down == "" {
+				return fmt.Errorf("migration %d has no down file", migration.Version)
+			}
+
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			err = run(ctx, conn, migration.Version, migration.down, previous)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// run executes a migration file, marking the database dirty at version for
+// as long as it runs. The files manage their own transactions, so a failure
+// can leave the schema half-migrated, which the dirty flag records.
+func run(ctx context.Context, conn *pgxpool.Conn, version int64, sql string, result int64) error {
+	err := setVersion(ctx, conn, version, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, sql)
+	if err != nil {
+		return err
+	}
+
+	return setVersion(ctx, conn, result, false)
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint NOT NULL PRIMARY KEY,
+    dirty boolean NOT NULL
+    )`
+
+	_, err = conn.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func getVersion(ctx context.Context, conn *pgxpool.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
+
+func setVersion(ctx context.Context, conn *pgxpool.Conn, version int64, dirty bool) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 || dirty {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,200 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/swsd2544/learny-backend-clone/internal/migrate"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// openTestDB connects to the database named by LEARNY_TEST_DB_DSN with a
+// fresh schema of its own as the search path, so that the migrations below
+// neither see nor touch the real ones. Tests needing Postgres are skipped
+// when it is not set.
+func openTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("LEARNY_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("LEARNY_TEST_DB_DSN is not set")
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close(context.Background()) })
+
+	_, err = admin.Exec(ctx, `CREATE SCHEMA `+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+	})
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id bigint);`)},
+		"000001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+		"000002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id bigint);`)},
+		"000002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+		"000003_create_c.up.sql":   {Data: []byte(`CREATE TABLE c (id bigint);`)},
+		"000003_create_c.down.sql": {Data: []byte(`DROP TABLE c;`)},
+	}
+}
+
+func checkStatus(t *testing.T, migrator *migrate.Migrator, version int64, dirty bool, pending int) {
+	t.Helper()
+
+	status, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Version != version || status.Dirty != dirty || len(status.Pending) != pending {
+		t.Fatalf("got version %d, dirty %t, %d pending; want version %d, dirty %t, %d pending",
+			status.Version, status.Dirty, len(status.Pending), version, dirty, pending)
+	}
+}
+
+func checkTables(t *testing.T, db *pgxpool.Pool, want map[string]bool) {
+	t.Helper()
+
+	for table, exists := range want {
+		var found bool
+		err := db.QueryRow(context.Background(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&found)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != exists {
+			t.Fatalf("table %s exists: got %t, want %t", table, found, exists)
+		}
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	migrator, err := migrate.New(db, testMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkStatus(t, migrator, 0, false, 3)
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 3, false, 0)
+	checkTables(t, db, map[string]bool{"a": true, "b": true, "c": true})
+
+	err = migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 2, false, 1)
+	checkTables(t, db, map[string]bool{"a": true, "b": true, "c": false})
+
+	err = migrator.Goto(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 1, false, 2)
+	checkTables(t, db, map[string]bool{"a": true, "b": false, "c": false})
+
+	err = migrator.Goto(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 3, false, 0)
+	checkTables(t, db, map[string]bool{"a": true, "b": true, "c": true})
+
+	err = migrator.Goto(ctx, 4)
+	if !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Fatalf("going to a missing version: got %v, want %v", err, migrate.ErrUnknownVersion)
+	}
+
+	err = migrator.Goto(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 0, false, 3)
+	checkTables(t, db, map[string]bool{"a": false, "b": false, "c": false})
+}
+
+// TestMigratorDirty checks that a failed migration leaves the database dirty,
+// that nothing more is migrated until Force marks it clean again, and that
+// migrating then resumes from the forced version.
+func TestMigratorDirty(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	fsys := testMigrations()
+	fsys["000003_create_c.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE c (id no_such_type);`)}
+
+	migrator, err := migrate.New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("applying a broken migration: got no error")
+	}
+	checkStatus(t, migrator, 3, true, 0)
+
+	err = migrator.Up(ctx)
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("migrating up while dirty: got %v, want %v", err, migrate.ErrDirty)
+	}
+
+	err = migrator.Down(ctx, 1)
+	if !errors.Is(err, migrate.ErrDirty) {
+		t.Fatalf("migrating down while dirty: got %v, want %v", err, migrate.ErrDirty)
+	}
+
+	err = migrator.Force(ctx, 4)
+	if !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Fatalf("forcing a missing version: got %v, want %v", err, migrate.ErrUnknownVersion)
+	}
+
+	err = migrator.Force(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 2, false, 1)
+
+	err = migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, 1, false, 2)
+	checkTables(t, db, map[string]bool{"a": true, "b": false})
+}
@@ -0,0 +1,334 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+type CharacterRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+func (r CharacterRepository) Insert(ctx context.Context, character *entity.Character) error {
+	query := `INSERT INTO characters (image_url, rarity) VALUES ($1, $2)
+    RETURNING id, retired, created_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.db.QueryRow(ctx, query, character.ImageURL, character.Rarity).Scan(&character.ID,
+		&character.Retired, &character.CreatedAt, &character.Version)
+}
+
+func (r CharacterRepository) Get(ctx context.Context, id int64) (*entity.Character, error) {
+	query := `SELECT id, image_url, rarity, retired, created_at, version FROM characters WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var character entity.Character
+	err := r.db.QueryRow(ctx, query, id).Scan(&character.ID, &character.ImageURL, &character.Rarity,
+		&character.Retired, &character.CreatedAt, &character.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &character, nil
+}
+
+// GetAll lists the character catalogue. Retired characters are only included
+// when includeRetired is set, and rarity restricts the list when not empty.
+func (r CharacterRepository) GetAll(ctx context.Context, includeRetired bool, rarity string, filters Filters) ([]*entity.Character, Metadata, error) {
+	condition, orderBy := filters.orderBy("characters", nil, 5)
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, image_url, rarity, retired, created_at, version
+    FROM characters WHERE ($1 OR NOT retired) AND ($2 = '' OR rarity = $2) AND %s
+    ORDER BY %s LIMIT $3 OFFSET $4`, condition, orderBy)
+
+	args := []any{includeRetired, rarity, filters.limit(), filters.offset()}
+	if filters.After != 0 {
+		args = append(args, filters.After)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	characters := []*entity.Character{}
+	for rows.Next() {
+		var character entity.Character
+		err := rows.Scan(&totalRecords, &character.ID, &character.ImageURL, &character.Rarity,
+			&character.Retired, &character.CreatedAt, &character.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		characters = append(characters, &character)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(characters) > 0 {
+		lastID = characters[len(characters)-1].ID
+	}
+
+	return characters, calculateMetadata(filters, totalRecords, lastID, len(characters)), nil
+}
+
+func (r CharacterRepository) Update(ctx context.Context, character *entity.Character) error {
+	query := `UPDATE characters SET image_url = $1, rarity = $2, retired = $3, version = version + 1
+    WHERE id = $4 AND version = $5 RETURNING version`
+
+	args := []any{character.ImageURL, character.Rarity, character.Retired, character.ID, character.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := r.db.QueryRow(ctx, query, args...).Scan(&character.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Draw performs a paid gacha draw for the user in a single transaction: the
+// banner cost is debited through the coin ledger, a character is picked and
+// the draw is recorded. Nothing is written when any step fails. It returns
+// the drawn character and the user's coin balance afterwards.
+func (r CharacterRepository) Draw(ctx context.Context, userID int64, banner entity.Banner) (*entity.Character, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var pity int
+	err = tx.QueryRow(ctx, `SELECT gacha_pity FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&pity)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	transaction := &entity.CoinTransaction{
+		UserID: userID,
+		Delta:  -banner.Cost,
+		Reason: "character draw",
+	}
+	balance, err := applyCoinTransaction(ctx, tx, transaction)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT DISTINCT rarity FROM characters WHERE NOT retired`)
+	if err != nil {
+		return nil, 0, err
+	}
+	var available []string
+	for rows.Next() {
+		var rarity string
+		err := rows.Scan(&rarity)
+		if err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		available = append(available, rarity)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	rarity, err := banner.PickRarity(pity, available)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, `SELECT count(*) FROM characters WHERE rarity = $1 AND NOT retired`, rarity).Scan(&count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n, err := entity.RandomInt(count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, image_url, rarity, retired, created_at, version FROM characters
+    WHERE rarity = $1 AND NOT retired ORDER BY id LIMIT 1 OFFSET $2`
+
+	var character entity.Character
+	err = tx.QueryRow(ctx, query, rarity, n).Scan(&character.ID, &character.ImageURL, &character.Rarity,
+		&character.Retired, &character.CreatedAt, &character.Version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = `INSERT INTO character_draws (user_id, character_id, rarity, coin_transaction_id)
+    VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.Exec(ctx, query, userID, character.ID, character.Rarity, transaction.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = `INSERT INTO user_characters (user_id, character_id) VALUES ($1, $2)
+    ON CONFLICT (user_id, character_id) DO UPDATE SET count = user_characters.count + 1`
+
+	_, err = tx.Exec(ctx, query, userID, character.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pity++
+	if entity.IsRare(character.Rarity) {
+		pity = 0
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET gacha_pity = $1 WHERE id = $2`, pity, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &character, balance, nil
+}
+
+// AddForUser puts the character in the user's collection without charging
+// for it, e.g. the default character given on registration.
+func (r CharacterRepository) AddForUser(ctx context.Context, userID, characterID int64) error {
+	query := `INSERT INTO user_characters (user_id, character_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, userID, characterID)
+	return err
+}
+
+func (r CharacterRepository) Owns(ctx context.Context, userID, characterID int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM user_characters WHERE user_id = $1 AND character_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var owns bool
+	err := r.db.QueryRow(ctx, query, userID, characterID).Scan(&owns)
+	return owns, err
+}
+
+// GetAllForUser lists the user's collection, optionally restricted to one
+// rarity when rarity is not empty.
+func (r CharacterRepository) GetAllForUser(ctx context.Context, userID int64, rarity string, filters Filters) ([]*entity.OwnedCharacter, Metadata, error) {
+	condition, orderBy := filters.orderBy("characters", nil, 5)
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), characters.id, characters.image_url, characters.rarity,
+    characters.retired, characters.created_at, characters.version, user_characters.count, user_characters.acquired_at
+    FROM characters INNER JOIN user_characters ON user_characters.character_id = characters.id
+    WHERE user_characters.user_id = $1 AND ($2 = '' OR characters.rarity = $2) AND %s
+    ORDER BY %s LIMIT $3 OFFSET $4`, condition, orderBy)
+
+	args := []any{userID, rarity, filters.limit(), filters.offset()}
+	if filters.After != 0 {
+		args = append(args, filters.After)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	characters := []*entity.OwnedCharacter{}
+	for rows.Next() {
+		var character entity.OwnedCharacter
+		err := rows.Scan(&totalRecords, &character.ID, &character.ImageURL, &character.Rarity,
+			&character.Retired, &character.CreatedAt, &character.Version, &character.Count, &character.AcquiredAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		characters = append(characters, &character)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(characters) > 0 {
+		lastID = characters[len(characters)-1].ID
+	}
+
+	return characters, calculateMetadata(filters, totalRecords, lastID, len(characters)), nil
+}
+
+// CountRaritiesForUser returns how many distinct characters of each rarity
+// the user owns. Every rarity is present in the result, possibly as zero.
+func (r CharacterRepository) CountRaritiesForUser(ctx context.Context, userID int64) (map[string]int, error) {
+	query := `SELECT characters.rarity, count(*) FROM characters
+    INNER JOIN user_characters ON user_characters.character_id = characters.id
+    WHERE user_characters.user_id = $1 GROUP BY characters.rarity`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for _, rarity := range entity.Rarities {
+		counts[rarity] = 0
+	}
+	for rows.Next() {
+		var rarity string
+		var count int
+		err := rows.Scan(&rarity, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[rarity] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
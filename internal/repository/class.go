@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+// The classes table stores the class name in its title column, every query
+// in this file maps it onto entity.Class.Name.
+
+type ClassRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+func (r ClassRepository) Insert(ctx context.Context, class *entity.Class) error {
+	query := `INSERT INTO classes (title, description, teacher_id) VALUES ($1, $2, $3)
+    RETURNING id, created_at, version`
+
+	args := []any{class.Name, class.Description, class.TeacherID}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.db.QueryRow(ctx, query, args...).Scan(&class.ID, &class.CreatedAt, &class.Version)
+}
+
+func (r ClassRepository) Get(ctx context.Context, id int64) (*entity.Class, error) {
+	query := `SELECT id, title, description, teacher_id, created_at, version
+    FROM classes WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var class entity.Class
+	err := r.db.QueryRow(ctx, query, id).Scan(&class.ID, &class.Name, &class.Description,
+		&class.TeacherID, &class.CreatedAt, &class.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &class, nil
+}
+
+// GetAll lists classes page by page. When enrolledUserID is non-zero only the
+// classes that user is enrolled in are returned.
+func (r ClassRepository) GetAll(ctx context.Context, enrolledUserID int64, filters Filters) ([]*entity.Class, Metadata, error) {
+	condition, orderBy := filters.orderBy("classes", map[string]string{"name": "title"}, 4)
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, title, description, teacher_id, created_at, version
+    FROM classes WHERE ($1::bigint = 0 OR id IN (SELECT class_id FROM enrollments WHERE user_id = $1))
+    AND %s ORDER BY %s LIMIT $2 OFFSET $3`, condition, orderBy)
+
+	args := []any{enrolledUserID, filters.limit(), filters.offset()}
+	if filters.After != 0 {
+		args = append(args, filters.After)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	classes := []*entity.Class{}
+	for rows.Next() {
+		var class entity.Class
+		err := rows.Scan(&totalRecords, &class.ID, &class.Name, &class.Description, &class.TeacherID,
+			&class.CreatedAt, &class.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		classes = append(classes, &class)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(classes) > 0 {
+		lastID = classes[len(classes)-1].ID
+	}
+
+	return classes, calculateMetadata(filters, totalRecords, lastID, len(classes)), nil
+}
+
+func (r ClassRepository) GetWithJoinCode(ctx context.Context, code string) (*entity.Class, error) {
+	query := `SELECT id, title, description, teacher_id, created_at, version
+    FROM classes WHERE join_code = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var class entity.Class
+	err := r.db.QueryRow(ctx, query, code).Scan(&class.ID, &class.Name, &class.Description,
+		&class.TeacherID, &class.CreatedAt, &class.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &class, nil
+}
+
+// SetJoinCode replaces the join code of the class, which invalidates the code
+// that was handed out before.
+func (r ClassRepository) SetJoinCode(ctx context.Context, classID int64, code string) error {
+	query := `UPDATE classes SET join_code = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, code, classID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r ClassRepository) Update(ctx context.Context, class *entity.Class) error {
+	query := `UPDATE classes SET title = $1, description = $2, version = version + 1
+    WHERE id = $3 AND version = $4 RETURNING version`
+
+	args := []any{class.Name, class.Description, class.ID, class.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := r.db.QueryRow(ctx, query, args...).Scan(&class.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r ClassRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM classes WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+var (
+	ErrInsufficientCoins = errors.New("insufficient coins")
+)
+
+type CoinRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+// Apply changes the balance of transaction.UserID by transaction.Delta and
+// records the change in the ledger, atomically. When the idempotency key was
+// already used for this user the earlier transaction is loaded into
+// transaction instead and the balance is left alone. It returns the balance
+// after the change.
+func (r CoinRepository) Apply(ctx context.Context, transaction *entity.CoinTransaction) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	balance, err := applyCoinTransaction(ctx, tx, transaction)
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, tx.Commit(ctx)
+}
+
+func applyCoinTransaction(ctx context.Context, tx pgx.Tx, transaction *entity.CoinTransaction) (int64, error) {
+	query := `INSERT INTO coin_transactions (user_id, delta, reason, actor_id, class_id, idempotency_key)
+    VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) ON CONFLICT (user_id, idempotency_key) DO NOTHING
+    RETURNING id, created_at`
+
+	args := []any{transaction.UserID, transaction.Delta, transaction.Reason, transaction.ActorID,
+		transaction.ClassID, transaction.IdempotencyKey}
+
+	err := tx.QueryRow(ctx, query, args...).Scan(&transaction.ID, &transaction.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		query = `SELECT coin_transactions.id, delta, reason, actor_id, class_id, coin_transactions.created_at, users.coin
+        FROM coin_transactions INNER JOIN users ON users.id = coin_transactions.user_id
+        WHERE user_id = $1 AND idempotency_key = $2`
+
+		var balance int64
+		err = tx.QueryRow(ctx, query, transaction.UserID, transaction.IdempotencyKey).Scan(&transaction.ID,
+			&transaction.Delta, &transaction.Reason, &transaction.ActorID, &transaction.ClassID,
+			&transaction.CreatedAt, &balance)
+		return balance, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE users SET coin = coin + $1 WHERE id = $2 AND coin + $1 >= 0 RETURNING coin`
+
+	var balance int64
+	err = tx.QueryRow(ctx, query, transaction.Delta, transaction.UserID).Scan(&balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return 0, ErrInsufficientCoins
+		default:
+			return 0, err
+		}
+	}
+
+	return balance, nil
+}
+
+func (r CoinRepository) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*entity.CoinTransaction, Metadata, error) {
+	condition, orderBy := filters.orderBy("coin_transactions", nil, 4)
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, user_id, delta, reason, actor_id, class_id, created_at
+    FROM coin_transactions WHERE user_id = $1 AND %s ORDER BY %s LIMIT $2 OFFSET $3`, condition, orderBy)
+
+	args := []any{userID, filters.limit(), filters.offset()}
+	if filters.After != 0 {
+		args = append(args, filters.After)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	transactions := []*entity.CoinTransaction{}
+	for rows.Next() {
+		var transaction entity.CoinTransaction
+		err := rows.Scan(&totalRecords, &transaction.ID, &transaction.UserID, &transaction.Delta,
+			&transaction.Reason, &transaction.ActorID, &transaction.ClassID, &transaction.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		transactions = append(transactions, &transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var lastID int64
+	if len(transactions) > 0 {
+		lastID = transactions[len(transactions)-1].ID
+	}
+
+	return transactions, calculateMetadata(filters, totalRecords, lastID, len(transactions)), nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAlreadyEnrolled = errors.New("already enrolled")
+)
+
+type EnrollmentRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+func (r EnrollmentRepository) Insert(ctx context.Context, userID, classID int64) error {
+	query := `INSERT INTO enrollments (user_id, class_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, userID, classID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAlreadyEnrolled
+	}
+
+	return nil
+}
+
+func (r EnrollmentRepository) Delete(ctx context.Context, userID, classID int64) error {
+	query := `DELETE FROM enrollments WHERE user_id = $1 AND class_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, userID, classID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r EnrollmentRepository) Exists(ctx context.Context, userID, classID int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM enrollments WHERE user_id = $1 AND class_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var exists bool
+	err := r.db.QueryRow(ctx, query, userID, classID).Scan(&exists)
+	return exists, err
+}
@@ -1,8 +1,157 @@
 package repository
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
 )
+
+// Classes of constraint violations, reported through a ConstraintError when
+// the violated constraint has no more specific error in constraintErrors.
+var (
+	ErrDuplicate        = errors.New("duplicate record")
+	ErrMissingReference = errors.New("referenced record does not exist")
+	ErrCheckViolation   = errors.New("check constraint violated")
+	ErrNotNullViolation = errors.New("required value missing")
+)
+
+// constraintErrors maps constraint names onto the errors the repositories
+// report when the constraint is violated.
+var constraintErrors = map[string]error{
+	"users_email_key":                ErrDuplicateEmail,
+	"users_coin_check":               ErrInsufficientCoins,
+	"enrollments_pkey":               ErrAlreadyEnrolled,
+	"enrollments_user_id_fkey":       ErrRecordNotFound,
+	"enrollments_class_id_fkey":      ErrRecordNotFound,
+	"tokens_user_id_fkey":            ErrRecordNotFound,
+	"coin_transactions_user_id_fkey": ErrRecordNotFound,
+}
+
+// ConstraintError reports a violated constraint that has no error of its
+// own. Err is one of ErrDuplicate, ErrMissingReference, ErrCheckViolation
+// and ErrNotNullViolation, so callers match it with errors.Is.
+type ConstraintError struct {
+	Err        error
+	Constraint string
+	Detail     string
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%v: %s", e.Err, e.Constraint)
+	}
+	return fmt.Sprintf("%v: %s (%s)", e.Err, e.Constraint, e.Detail)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// translateError turns constraint violations reported by Postgres into the
+// errors of this package. Any other error is returned unchanged.
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if domainErr, ok := constraintErrors[pgErr.ConstraintName]; ok {
+		return domainErr
+	}
+
+	var class error
+	switch pgErr.Code {
+	case "23505":
+		class = ErrDuplicate
+	case "23503":
+		class = ErrMissingReference
+	case "23514":
+		class = ErrCheckViolation
+	case "23502":
+		return &ConstraintError{Err: ErrNotNullViolation, Constraint: pgErr.TableName + "." + pgErr.ColumnName}
+	default:
+		return err
+	}
+
+	return &ConstraintError{Err: class, Constraint: pgErr.ConstraintName, Detail: pgErr.Detail}
+}
+
+// translatingDB passes every error the database returns through
+// translateError, so that the repositories never see a raw constraint
+// violation.
+type translatingDB struct {
+	db dbtx
+}
+
+func (t translatingDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	tag, err := t.db.Exec(ctx, sql, arguments...)
+	return tag, translateError(err)
+}
+
+func (t translatingDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := t.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return translatingRows{Rows: rows}, nil
+}
+
+func (t translatingDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return translatingRow{row: t.db.QueryRow(ctx, sql, args...)}
+}
+
+func (t translatingDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return translatingTx{Tx: tx}, nil
+}
+
+type translatingRow struct {
+	row pgx.Row
+}
+
+func (t translatingRow) Scan(dest ...any) error {
+	return translateError(t.row.Scan(dest...))
+}
+
+type translatingRows struct {
+	pgx.Rows
+}
+
+func (t translatingRows) Err() error {
+	return translateError(t.Rows.Err())
+}
+
+// translatingTx covers the transactions repositories start themselves.
+type translatingTx struct {
+	pgx.Tx
+}
+
+func (t translatingTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return translatingDB{db: t.Tx}.Begin(ctx)
+}
+
+func (t translatingTx) Commit(ctx context.Context) error {
+	return translateError(t.Tx.Commit(ctx))
+}
+
+func (t translatingTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return translatingDB{db: t.Tx}.Exec(ctx, sql, arguments...)
+}
+
+func (t translatingTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return translatingDB{db: t.Tx}.Query(ctx, sql, args...)
+}
+
+func (t translatingTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return translatingDB{db: t.Tx}.QueryRow(ctx, sql, args...)
+}
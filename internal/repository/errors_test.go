@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+func TestTranslateError(t *testing.T) {
+	other := errors.New("other")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"not a postgres error", other, other},
+		{"no rows", pgx.ErrNoRows, pgx.ErrNoRows},
+		{"duplicate email", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, ErrDuplicateEmail},
+		{"wrapped duplicate email", fmt.Errorf("insert: %w",
+			&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}), ErrDuplicateEmail},
+		{"negative balance", &pgconn.PgError{Code: "23514", ConstraintName: "users_coin_check"}, ErrInsufficientCoins},
+		{"unknown class", &pgconn.PgError{Code: "23503", ConstraintName: "enrollments_class_id_fkey"}, ErrRecordNotFound},
+		{"unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "classes_join_code_key"}, ErrDuplicate},
+		{"foreign key violation", &pgconn.PgError{Code: "23503", ConstraintName: "character_draws_character_id_fkey"}, ErrMissingReference},
+		{"check violation", &pgconn.PgError{Code: "23514", ConstraintName: "coin_transactions_delta_check"}, ErrCheckViolation},
+		{"not null violation", &pgconn.PgError{Code: "23502", TableName: "users", ColumnName: "hash_password"}, ErrNotNullViolation},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+
+			if tt.want == nil && tt.err != nil {
+				if got != tt.err {
+					t.Fatalf("got %v, want the error unchanged", got)
+				}
+				return
+			}
+
+			if !errors.Is(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintErrorMessage(t *testing.T) {
+	err := translateError(&pgconn.PgError{Code: "23505", ConstraintName: "classes_join_code_key",
+		Detail: "Key (join_code)=(ABCDEFGH) already exists."})
+
+	var constraintErr *ConstraintError
+	if !errors.As(err, &constraintErr) || constraintErr.Constraint != "classes_join_code_key" {
+		t.Fatalf("got %#v, want a ConstraintError for classes_join_code_key", err)
+	}
+
+	want := "duplicate record: classes_join_code_key (Key (join_code)=(ABCDEFGH) already exists.)"
+	if err.Error() != want {
+		t.Fatalf("got message %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/validator"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Filters is the pagination and sorting contract shared by every list
+// endpoint. Sort names a key from SortSafelist, optionally prefixed with "-"
+// for descending order. When After is set the page is selected by keyset
+// (the rows following the row with that id in sort order) instead of by Page.
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	After        int64
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.Check(f.After >= 0, "after", "must not be negative")
+
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+}
+
+// sortColumn returns the sort key with any "-" prefix removed. columns maps
+// sort keys onto column names where the two differ. It panics on a key that
+// is not in the safelist, as a last line of defence against SQL injection.
+func (f Filters) sortColumn(columns map[string]string) string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			key := strings.TrimPrefix(f.Sort, "-")
+			if column, ok := columns[key]; ok {
+				return column
+			}
+			return key
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// orderBy builds the ORDER BY clause, and when After is set a matching
+// keyset condition, for a query against table. The condition refers to the
+// cursor row through the placeholder $n and is "TRUE" when no cursor is set.
+func (f Filters) orderBy(table string, columns map[string]string, n int) (condition, orderBy string) {
+	column := f.sortColumn(columns)
+	direction := f.sortDirection()
+
+	orderBy = fmt.Sprintf("%s.%s %s, %s.id %s", table, column, direction, table, direction)
+
+	if f.After == 0 {
+		return "TRUE", orderBy
+	}
+
+	operator := ">"
+	if direction == "DESC" {
+		operator = "<"
+	}
+
+	condition = fmt.Sprintf("(%s.%s, %s.id) %s (SELECT %s, id FROM %s WHERE id = $%d)",
+		table, column, table, operator, column, table, n)
+
+	return condition, orderBy
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	if f.After != 0 {
+		return 0
+	}
+	return (f.Page - 1) * f.PageSize
+}
+
+type Metadata struct {
+	CurrentPage  int   `json:"current_page,omitempty"`
+	PageSize     int   `json:"page_size,omitempty"`
+	FirstPage    int   `json:"first_page,omitempty"`
+	LastPage     int   `json:"last_page,omitempty"`
+	TotalRecords int   `json:"total_records,omitempty"`
+	NextCursor   int64 `json:"next_cursor,omitempty"`
+}
+
+// calculateMetadata derives the pagination metadata from the total number of
+// matching records, as returned by count(*) OVER(), and the id of the last
+// row on the page.
+func calculateMetadata(f Filters, totalRecords int, lastID int64, rows int) Metadata {
+	if f.After != 0 {
+		metadata := Metadata{PageSize: f.PageSize}
+		if rows == f.PageSize && totalRecords > rows {
+			metadata.NextCursor = lastID
+		}
+		return metadata
+	}
+
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	metadata := Metadata{
+		CurrentPage:  f.Page,
+		PageSize:     f.PageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(f.PageSize))),
+		TotalRecords: totalRecords,
+	}
+	if f.Page*f.PageSize < totalRecords {
+		metadata.NextCursor = lastID
+	}
+
+	return metadata
+}
+
+// Paginate applies f to rows held in memory the way orderBy, limit and offset
+// do in SQL, for implementations that are not backed by Postgres. compare
+// maps each sort key onto a function ordering two rows by that key; ties are
+// broken by id, as in SQL.
+func Paginate[T any](f Filters, rows []T, id func(T) int64, compare map[string]func(a, b T) int) ([]T, Metadata) {
+	key := f.sortColumn(nil)
+	descending := f.sortDirection() == "DESC"
+
+	sorted := make([]T, len(rows))
+	copy(sorted, rows)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c := compare[key](sorted[i], sorted[j])
+		if c == 0 {
+			switch a, b := id(sorted[i]), id(sorted[j]); {
+			case a < b:
+				c = -1
+			case a > b:
+				c = 1
+			}
+		}
+		if descending {
+			c = -c
+		}
+		return c < 0
+	})
+
+	if f.After != 0 {
+		cursor := -1
+		for i, row := range sorted {
+			if id(row) == f.After {
+				cursor = i
+				break
+			}
+		}
+		if cursor == -1 {
+			sorted = nil
+		} else {
+			sorted = sorted[cursor+1:]
+		}
+	}
+
+	start := f.offset()
+	if start > len(sorted) {
+		start = len(sorted)
+	}
+	end := start + f.limit()
+	if end > len(sorted) {
+		end = len(sorted)
+	}
+
+	page := sorted[start:end]
+
+	totalRecords := len(sorted)
+	if len(page) == 0 {
+		totalRecords = 0
+	}
+
+	var lastID int64
+	if len(page) > 0 {
+		lastID = id(page[len(page)-1])
+	}
+
+	return page, calculateMetadata(f, totalRecords, lastID, len(page))
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+type LoginFailureRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+// LockedUntil returns the latest time until which any of the keys is locked.
+// The zero time means none of them is.
+func (r LoginFailureRepository) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	query := `SELECT max(locked_until) FROM login_failures WHERE key = ANY($1) AND locked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var lockedUntil *time.Time
+	err := r.db.QueryRow(ctx, query, keys).Scan(&lockedUntil)
+	if err != nil || lockedUntil == nil {
+		return time.Time{}, err
+	}
+
+	return *lockedUntil, nil
+}
+
+// Record counts a failed login against key and locks it as the policy says.
+// The row expires once both the lock and the policy's window have passed.
+func (r LoginFailureRepository) Record(ctx context.Context, key string, policy entity.LoginPolicy) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO login_failures AS f (key, failures) VALUES ($1, 1)
+    ON CONFLICT (key) DO UPDATE SET
+        failures = CASE WHEN f.last_failure_at < NOW() - $2::interval THEN 1 ELSE f.failures + 1 END,
+        last_failure_at = NOW()
+    RETURNING failures`
+
+	var failures int
+	err = tx.QueryRow(ctx, query, key, policy.Window).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	lockedUntil := policy.LockedUntil(failures, time.Now())
+
+	query = `UPDATE login_failures SET locked_until = $1, expires_at = GREATEST($1, last_failure_at + $2::interval)
+    WHERE key = $3`
+
+	_, err = tx.Exec(ctx, query, lockedUntil, policy.Window, key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Reset forgets every failed login counted against key, unlocking it.
+func (r LoginFailureRepository) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_failures WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, key)
+	return err
+}
+
+// DeleteStale deletes at most batchSize failures whose lock and window have
+// both passed and reports how many were deleted. Callers wanting everything
+// gone keep calling it until it returns fewer than batchSize.
+func (r LoginFailureRepository) DeleteStale(ctx context.Context, batchSize int) (int64, error) {
+	query := `DELETE FROM login_failures WHERE key IN (
+    SELECT key FROM login_failures WHERE expires_at <= NOW() LIMIT $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
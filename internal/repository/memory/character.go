@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+)
+
+// CharacterRepository only keeps which characters the users own. The
+// catalogue lives in Postgres alone, so every method that reads or changes
+// it returns ErrNotSupported.
+type CharacterRepository struct {
+	s *store
+}
+
+func (r CharacterRepository) Insert(ctx context.Context, character *entity.Character) error {
+	return ErrNotSupported
+}
+
+func (r CharacterRepository) Get(ctx context.Context, id int64) (*entity.Character, error) {
+	return nil, ErrNotSupported
+}
+
+func (r CharacterRepository) GetAll(ctx context.Context, includeRetired bool, rarity string, filters repository.Filters) ([]*entity.Character, repository.Metadata, error) {
+	return nil, repository.Metadata{}, ErrNotSupported
+}
+
+func (r CharacterRepository) Update(ctx context.Context, character *entity.Character) error {
+	return ErrNotSupported
+}
+
+func (r CharacterRepository) Draw(ctx context.Context, userID int64, banner entity.Banner) (*entity.Character, int64, error) {
+	return nil, 0, ErrNotSupported
+}
+
+func (r CharacterRepository) AddForUser(ctx context.Context, userID, characterID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return &repository.ConstraintError{Err: repository.ErrMissingReference, Constraint: "user_characters_user_id_fkey"}
+	}
+
+	r.s.ownedCharacters[ownership{userID: userID, characterID: characterID}] = struct{}{}
+	return nil
+}
+
+func (r CharacterRepository) Owns(ctx context.Context, userID, characterID int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, ok := r.s.ownedCharacters[ownership{userID: userID, characterID: characterID}]
+	return ok, nil
+}
+
+func (r CharacterRepository) GetAllForUser(ctx context.Context, userID int64, rarity string, filters repository.Filters) ([]*entity.OwnedCharacter, repository.Metadata, error) {
+	return nil, repository.Metadata{}, ErrNotSupported
+}
+
+func (r CharacterRepository) CountRaritiesForUser(ctx context.Context, userID int64) (map[string]int, error) {
+	return nil, ErrNotSupported
+}
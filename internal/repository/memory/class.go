@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"strings"
+	"time"
+)
+
+type ClassRepository struct {
+	s *store
+}
+
+func (r ClassRepository) Insert(ctx context.Context, c *entity.Class) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c.ID = r.s.nextID()
+	c.CreatedAt = time.Now()
+	c.Version = 1
+
+	r.s.classes[c.ID] = &class{Class: *c}
+	return nil
+}
+
+func (r ClassRepository) Get(ctx context.Context, id int64) (*entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.classes[id]
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	c := stored.Class
+	return &c, nil
+}
+
+func (r ClassRepository) GetAll(ctx context.Context, enrolledUserID int64, filters repository.Filters) ([]*entity.Class, repository.Metadata, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var classes []*entity.Class
+	for _, stored := range r.s.classes {
+		if enrolledUserID != 0 {
+			if _, ok := r.s.enrollments[enrollment{userID: enrolledUserID, classID: stored.ID}]; !ok {
+				continue
+			}
+		}
+
+		c := stored.Class
+		classes = append(classes, &c)
+	}
+
+	compare := map[string]func(a, b *entity.Class) int{
+		"id":   func(a, b *entity.Class) int { return 0 },
+		"name": func(a, b *entity.Class) int { return strings.Compare(a.Name, b.Name) },
+		"created_at": func(a, b *entity.Class) int {
+			return compareInt64(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+		},
+	}
+
+	classes, metadata := repository.Paginate(filters, classes, func(c *entity.Class) int64 { return c.ID }, compare)
+	if classes == nil {
+		classes = []*entity.Class{}
+	}
+
+	return classes, metadata, nil
+}
+
+func (r ClassRepository) GetWithJoinCode(ctx context.Context, code string) (*entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, stored := range r.s.classes {
+		if code != "" && stored.joinCode == code {
+			c := stored.Class
+			return &c, nil
+		}
+	}
+
+	return nil, repository.ErrRecordNotFound
+}
+
+func (r ClassRepository) SetJoinCode(ctx context.Context, classID int64, code string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.classes[classID]
+	if !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	stored.joinCode = code
+	return nil
+}
+
+func (r ClassRepository) Update(ctx context.Context, c *entity.Class) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.classes[c.ID]
+	if !ok || stored.Version != c.Version {
+		return repository.ErrEditConflict
+	}
+
+	stored.Name = c.Name
+	stored.Description = c.Description
+	stored.Version++
+
+	c.Version = stored.Version
+	return nil
+}
+
+func (r ClassRepository) Delete(ctx context.Context, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.classes[id]; !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	delete(r.s.classes, id)
+	for e := range r.s.enrollments {
+		if e.classID == id {
+			delete(r.s.enrollments, e)
+		}
+	}
+
+	// Snapshots share the stored transactions, so they are replaced rather
+	// than changed.
+	for i, stored := range r.s.transactions {
+		if stored.ClassID != nil && *stored.ClassID == id {
+			transaction := *stored
+			transaction.ClassID = nil
+			r.s.transactions[i] = &transaction
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"time"
+)
+
+type CoinRepository struct {
+	s *store
+}
+
+func (r CoinRepository) Apply(ctx context.Context, transaction *entity.CoinTransaction) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[transaction.UserID]
+	if !ok {
+		return 0, repository.ErrRecordNotFound
+	}
+
+	if transaction.IdempotencyKey != "" {
+		for _, earlier := range r.s.transactions {
+			if earlier.UserID == transaction.UserID && earlier.IdempotencyKey == transaction.IdempotencyKey {
+				*transaction = *earlier
+				return user.Coin, nil
+			}
+		}
+	}
+
+	if transaction.ClassID != nil {
+		if _, ok := r.s.classes[*transaction.ClassID]; !ok {
+			return 0, &repository.ConstraintError{Err: repository.ErrMissingReference, Constraint: "coin_transactions_class_id_fkey"}
+		}
+	}
+
+	if user.Coin+transaction.Delta < 0 {
+		return 0, repository.ErrInsufficientCoins
+	}
+
+	transaction.ID = r.s.nextID()
+	transaction.CreatedAt = time.Now()
+
+	stored := *transaction
+	r.s.transactions = append(r.s.transactions, &stored)
+	user.Coin += transaction.Delta
+
+	return user.Coin, nil
+}
+
+func (r CoinRepository) GetAllForUser(ctx context.Context, userID int64, filters repository.Filters) ([]*entity.CoinTransaction, repository.Metadata, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var transactions []*entity.CoinTransaction
+	for _, stored := range r.s.transactions {
+		if stored.UserID == userID {
+			transaction := *stored
+			transaction.IdempotencyKey = ""
+			transactions = append(transactions, &transaction)
+		}
+	}
+
+	compare := map[string]func(a, b *entity.CoinTransaction) int{
+		"id": func(a, b *entity.CoinTransaction) int { return 0 },
+	}
+
+	transactions, metadata := repository.Paginate(filters, transactions,
+		func(t *entity.CoinTransaction) int64 { return t.ID }, compare)
+	if transactions == nil {
+		transactions = []*entity.CoinTransaction{}
+	}
+
+	return transactions, metadata, nil
+}
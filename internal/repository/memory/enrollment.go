@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+)
+
+type EnrollmentRepository struct {
+	s *store
+}
+
+func (r EnrollmentRepository) Insert(ctx context.Context, userID, classID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, userExists := r.s.users[userID]
+	_, classExists := r.s.classes[classID]
+	if !userExists || !classExists {
+		return repository.ErrRecordNotFound
+	}
+
+	e := enrollment{userID: userID, classID: classID}
+	if _, ok := r.s.enrollments[e]; ok {
+		return repository.ErrAlreadyEnrolled
+	}
+
+	r.s.enrollments[e] = struct{}{}
+	return nil
+}
+
+func (r EnrollmentRepository) Delete(ctx context.Context, userID, classID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	e := enrollment{userID: userID, classID: classID}
+	if _, ok := r.s.enrollments[e]; !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	delete(r.s.enrollments, e)
+	return nil
+}
+
+func (r EnrollmentRepository) Exists(ctx context.Context, userID, classID int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, ok := r.s.enrollments[enrollment{userID: userID, classID: classID}]
+	return ok, nil
+}
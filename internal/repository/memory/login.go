@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+type LoginFailureRepository struct {
+	s *store
+}
+
+func (r LoginFailureRepository) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	var lockedUntil time.Time
+	for _, key := range keys {
+		f, ok := r.s.loginFailures[key]
+		if ok && f.lockedUntil.After(now) && f.lockedUntil.After(lockedUntil) {
+			lockedUntil = f.lockedUntil
+		}
+	}
+
+	return lockedUntil, nil
+}
+
+func (r LoginFailureRepository) Record(ctx context.Context, key string, policy entity.LoginPolicy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	f, ok := r.s.loginFailures[key]
+	if !ok || f.lastFailureAt.Before(now.Add(-policy.Window)) {
+		f.failures = 0
+	}
+
+	f.failures++
+	f.lastFailureAt = now
+	f.lockedUntil = policy.LockedUntil(f.failures, now)
+	f.expiresAt = now.Add(policy.Window)
+	if f.lockedUntil.After(f.expiresAt) {
+		f.expiresAt = f.lockedUntil
+	}
+	r.s.loginFailures[key] = f
+
+	return nil
+}
+
+func (r LoginFailureRepository) Reset(ctx context.Context, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.loginFailures, key)
+	return nil
+}
+
+func (r LoginFailureRepository) DeleteStale(ctx context.Context, batchSize int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	var deleted int64
+	for key, f := range r.s.loginFailures {
+		if deleted == int64(batchSize) {
+			break
+		}
+		if !f.expiresAt.After(now) {
+			delete(r.s.loginFailures, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
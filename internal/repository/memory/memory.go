@@ -0,0 +1,226 @@
+// Package memory implements the repository interfaces in memory, so that
+// handlers can be exercised without a Postgres server. It follows the error
+// contracts of the Postgres implementation; the conformance suite in package
+// repositorytest holds both to them.
+package memory
+
+import (
+	"context"
+	"errors"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported is returned by the methods that have no in-memory
+// implementation.
+var ErrNotSupported = errors.New("not supported by the in-memory repositories")
+
+// store holds the data shared between the repositories, the way the tables
+// of one database are. A single mutex guards all of it.
+type store struct {
+	mu sync.Mutex
+
+	users           map[int64]*entity.User
+	pendingEmails   map[int64]string
+	permissions     map[int64]entity.Permissions
+	ownedCharacters map[ownership]struct{}
+	tokens          map[string]*token
+	classes         map[int64]*class
+	enrollments     map[enrollment]struct{}
+	transactions    []*entity.CoinTransaction
+	twoFactor       map[int64]*twoFactor
+	loginFailures   map[string]loginFailure
+
+	lastID int64
+}
+
+type token struct {
+	entity.Token
+	rotated    bool
+	lastUsedAt *time.Time
+}
+
+type class struct {
+	entity.Class
+	joinCode string
+}
+
+type enrollment struct {
+	userID  int64
+	classID int64
+}
+
+// twoFactor holds the totp columns of a user other than totp_enabled, which
+// lives on the user itself, and the user's recovery codes with whether each
+// has been used.
+type ownership struct {
+	userID      int64
+	characterID int64
+}
+
+type twoFactor struct {
+	secret        []byte
+	lastStep      int64
+	recoveryCodes map[string]bool
+}
+
+type loginFailure struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+	expiresAt     time.Time
+}
+
+// New returns Repositories that share one empty in-memory store. Of the
+// Characters repository only the users' collections are implemented.
+func New() repository.Repositories {
+	s := &store{
+		users:           make(map[int64]*entity.User),
+		pendingEmails:   make(map[int64]string),
+		permissions:     make(map[int64]entity.Permissions),
+		ownedCharacters: make(map[ownership]struct{}),
+		tokens:          make(map[string]*token),
+		classes:         make(map[int64]*class),
+		enrollments:     make(map[enrollment]struct{}),
+		twoFactor:       make(map[int64]*twoFactor),
+		loginFailures:   make(map[string]loginFailure),
+	}
+
+	repositories := repository.Repositories{
+		Users:       UserRepository{s: s},
+		Tokens:      TokenRepository{s: s},
+		Permissions: PermissionRepository{s: s},
+		Classes:     ClassRepository{s: s},
+		Enrollments: EnrollmentRepository{s: s},
+		Coins:       CoinRepository{s: s},
+		Characters:  CharacterRepository{s: s},
+		Logins:      LoginFailureRepository{s: s},
+		TwoFactor:   TwoFactorRepository{s: s},
+	}
+	repositories.Transactor = transactor{s: s, repositories: &repositories}
+
+	return repositories
+}
+
+// transactor undoes every change made by fn when it fails by restoring a
+// snapshot of the store. Unlike a database transaction it does not isolate
+// fn from concurrent writers, whose changes a rollback discards as well.
+type transactor struct {
+	s            *store
+	repositories *repository.Repositories
+}
+
+func (t transactor) WithinTx(ctx context.Context, fn func(repository.Repositories) error) error {
+	snapshot := t.s.snapshot()
+
+	err := fn(*t.repositories)
+	if err != nil {
+		t.s.restore(snapshot)
+	}
+
+	return err
+}
+
+func (s *store) snapshot() *store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &store{
+		users:           make(map[int64]*entity.User, len(s.users)),
+		pendingEmails:   make(map[int64]string, len(s.pendingEmails)),
+		permissions:     make(map[int64]entity.Permissions, len(s.permissions)),
+		ownedCharacters: make(map[ownership]struct{}, len(s.ownedCharacters)),
+		tokens:          make(map[string]*token, len(s.tokens)),
+		classes:         make(map[int64]*class, len(s.classes)),
+		enrollments:     make(map[enrollment]struct{}, len(s.enrollments)),
+		transactions:    make([]*entity.CoinTransaction, len(s.transactions)),
+		twoFactor:       make(map[int64]*twoFactor, len(s.twoFactor)),
+		loginFailures:   make(map[string]loginFailure, len(s.loginFailures)),
+		lastID:          s.lastID,
+	}
+
+	for id, user := range s.users {
+		u := *user
+		c.users[id] = &u
+	}
+	for id, email := range s.pendingEmails {
+		c.pendingEmails[id] = email
+	}
+	for id, permissions := range s.permissions {
+		c.permissions[id] = append(entity.Permissions(nil), permissions...)
+	}
+	for o := range s.ownedCharacters {
+		c.ownedCharacters[o] = struct{}{}
+	}
+	for hash, t := range s.tokens {
+		t := *t
+		c.tokens[hash] = &t
+	}
+	for id, cl := range s.classes {
+		cl := *cl
+		c.classes[id] = &cl
+	}
+	for e := range s.enrollments {
+		c.enrollments[e] = struct{}{}
+	}
+	copy(c.transactions, s.transactions)
+	for id, tf := range s.twoFactor {
+		recoveryCodes := make(map[string]bool, len(tf.recoveryCodes))
+		for hash, used := range tf.recoveryCodes {
+			recoveryCodes[hash] = used
+		}
+		c.twoFactor[id] = &twoFactor{secret: tf.secret, lastStep: tf.lastStep, recoveryCodes: recoveryCodes}
+	}
+	for key, f := range s.loginFailures {
+		c.loginFailures[key] = f
+	}
+
+	return c
+}
+
+func (s *store) restore(snapshot *store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = snapshot.users
+	s.pendingEmails = snapshot.pendingEmails
+	s.permissions = snapshot.permissions
+	s.ownedCharacters = snapshot.ownedCharacters
+	s.tokens = snapshot.tokens
+	s.classes = snapshot.classes
+	s.enrollments = snapshot.enrollments
+	s.transactions = snapshot.transactions
+	s.twoFactor = snapshot.twoFactor
+	s.loginFailures = snapshot.loginFailures
+	s.lastID = snapshot.lastID
+}
+
+// nextID plays the part of the bigserial columns. Ids are unique across all
+// tables, which is allowed by, and stricter than, the Postgres contract.
+func (s *store) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+// userWithEmail looks up a user the way the citext email column compares.
+func (s *store) userWithEmail(email string) *entity.User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+package memory_test
+
+import (
+	"github.com/swsd2544/learny-backend-clone/internal/repository/memory"
+	"github.com/swsd2544/learny-backend-clone/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, memory.New())
+}
@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+)
+
+type PermissionRepository struct {
+	s *store
+}
+
+func (r PermissionRepository) GetAllForUser(ctx context.Context, userID int64) (entity.Permissions, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return append(entity.Permissions(nil), r.s.permissions[userID]...), nil
+}
+
+func (r PermissionRepository) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return &repository.ConstraintError{Err: repository.ErrMissingReference, Constraint: "users_permissions_user_id_fkey"}
+	}
+
+	for _, code := range codes {
+		if entity.AllPermissions.Include(code) && !r.s.permissions[userID].Include(code) {
+			r.s.permissions[userID] = append(r.s.permissions[userID], code)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"sort"
+	"time"
+)
+
+type TokenRepository struct {
+	s *store
+}
+
+func (r TokenRepository) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*entity.Token, error) {
+	token, err := entity.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Insert(ctx, token)
+	return token, err
+}
+
+func (r TokenRepository) Insert(ctx context.Context, t *entity.Token) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[t.UserID]; !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	t.ID = r.s.nextID()
+	t.CreatedAt = time.Now()
+
+	r.s.tokens[string(t.Hash)] = &token{Token: *t}
+	return nil
+}
+
+func (r TokenRepository) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteTokens(func(t *token) bool {
+		return t.Scope == scope && t.UserID == userID
+	})
+	return nil
+}
+
+func (r TokenRepository) Rotate(ctx context.Context, tokenPlaintext string) (*entity.Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.tokens[string(tokenHash[:])]
+	if !ok || t.Scope != entity.ScopeRefresh || !t.Expiry.After(time.Now()) {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	rotated := entity.Token{
+		Plaintext: tokenPlaintext,
+		Hash:      tokenHash[:],
+		UserID:    t.UserID,
+		Expiry:    t.Expiry,
+		Scope:     entity.ScopeRefresh,
+		Family:    t.Family,
+	}
+
+	if t.rotated {
+		return &rotated, repository.ErrTokenReused
+	}
+
+	t.rotated = true
+	return &rotated, nil
+}
+
+func (r TokenRepository) DeleteFamily(ctx context.Context, family string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteTokens(func(t *token) bool {
+		return family != "" && t.Family == family
+	})
+	return nil
+}
+
+func (r TokenRepository) DeleteFamilyOfHash(ctx context.Context, hash []byte) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var family string
+	if t, ok := r.s.tokens[string(hash)]; ok {
+		family = t.Family
+	}
+
+	r.s.deleteTokens(func(t *token) bool {
+		return string(t.Hash) == string(hash) || (family != "" && t.Family == family)
+	})
+	return nil
+}
+
+func (r TokenRepository) GetSessionsForUser(ctx context.Context, userID int64, currentHash []byte) ([]*entity.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	sessions := make(map[string]*entity.Session)
+	latest := make(map[string]*token)
+	usable := make(map[string]bool)
+
+	for _, t := range r.s.tokens {
+		if t.UserID != userID || t.Family == "" || !t.Expiry.After(now) {
+			continue
+		}
+
+		session, ok := sessions[t.Family]
+		if !ok {
+			session = &entity.Session{ID: t.Family, CreatedAt: t.CreatedAt, Expiry: t.Expiry}
+			sessions[t.Family] = session
+		}
+
+		if t.CreatedAt.Before(session.CreatedAt) {
+			session.CreatedAt = t.CreatedAt
+		}
+		if t.Expiry.After(session.Expiry) {
+			session.Expiry = t.Expiry
+		}
+		if t.lastUsedAt != nil && (session.LastUsedAt == nil || t.lastUsedAt.After(*session.LastUsedAt)) {
+			lastUsedAt := *t.lastUsedAt
+			session.LastUsedAt = &lastUsedAt
+		}
+		if string(t.Hash) == string(currentHash) {
+			session.Current = true
+		}
+		if t.Scope == entity.ScopeRefresh && !t.rotated {
+			usable[t.Family] = true
+		}
+		if latest[t.Family] == nil || t.ID > latest[t.Family].ID {
+			latest[t.Family] = t
+		}
+	}
+
+	list := []*entity.Session{}
+	for family, session := range sessions {
+		if !usable[family] {
+			continue
+		}
+		session.UserAgent = latest[family].UserAgent
+		session.IP = latest[family].IP
+		list = append(list, session)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch {
+		case a.LastUsedAt != nil && b.LastUsedAt != nil && !a.LastUsedAt.Equal(*b.LastUsedAt):
+			return a.LastUsedAt.After(*b.LastUsedAt)
+		case (a.LastUsedAt == nil) != (b.LastUsedAt == nil):
+			return a.LastUsedAt != nil
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+
+	return list, nil
+}
+
+func (r TokenRepository) DeleteOtherSessions(ctx context.Context, userID int64, hash []byte) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var family string
+	if t, ok := r.s.tokens[string(hash)]; ok {
+		family = t.Family
+	}
+
+	r.s.deleteTokens(func(t *token) bool {
+		return t.UserID == userID && t.Family != family &&
+			(t.Scope == entity.ScopeAuthentication || t.Scope == entity.ScopeRefresh)
+	})
+	return nil
+}
+
+func (r TokenRepository) DeleteSessionForUser(ctx context.Context, userID int64, family string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	deleted := r.s.deleteTokens(func(t *token) bool {
+		return t.UserID == userID && family != "" && t.Family == family
+	})
+	if deleted == 0 {
+		return repository.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r TokenRepository) TouchLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for hash, at := range lastUsed {
+		if t, ok := r.s.tokens[hash]; ok {
+			at := at
+			t.lastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r TokenRepository) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	remaining := batchSize
+
+	deleted := r.s.deleteTokens(func(t *token) bool {
+		if remaining == 0 || t.Expiry.After(now) {
+			return false
+		}
+		remaining--
+		return true
+	})
+
+	return deleted, nil
+}
+
+// deleteTokens deletes the tokens matching fn and returns how many there were.
+func (s *store) deleteTokens(fn func(t *token) bool) int64 {
+	var deleted int64
+	for hash, t := range s.tokens {
+		if fn(t) {
+			delete(s.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted
+}
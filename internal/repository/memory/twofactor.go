@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+)
+
+type TwoFactorRepository struct {
+	s *store
+}
+
+func (r TwoFactorRepository) SetPendingSecret(ctx context.Context, userID int64, sealedSecret []byte) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok || user.TOTPEnabled {
+		return repository.ErrEditConflict
+	}
+
+	r.s.twoFactor[userID] = &twoFactor{
+		secret:        append([]byte(nil), sealedSecret...),
+		recoveryCodes: r.s.recoveryCodes(userID),
+	}
+
+	return nil
+}
+
+func (r TwoFactorRepository) GetSecret(ctx context.Context, userID int64) ([]byte, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tf, ok := r.s.twoFactor[userID]
+	if !ok || tf.secret == nil {
+		return nil, false, repository.ErrRecordNotFound
+	}
+
+	return append([]byte(nil), tf.secret...), r.s.users[userID].TOTPEnabled, nil
+}
+
+func (r TwoFactorRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return false, nil
+	}
+
+	tf := r.s.twoFactorOf(userID)
+	if tf.lastStep >= step {
+		return false, nil
+	}
+
+	tf.lastStep = step
+	return true, nil
+}
+
+func (r TwoFactorRepository) Enable(ctx context.Context, userID int64, recoveryCodeHashes [][]byte) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok || user.TOTPEnabled {
+		return repository.ErrEditConflict
+	}
+
+	user.TOTPEnabled = true
+	user.Version++
+
+	tf := r.s.twoFactorOf(userID)
+	tf.recoveryCodes = make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		tf.recoveryCodes[string(hash)] = false
+	}
+
+	return nil
+}
+
+func (r TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tf, ok := r.s.twoFactor[userID]
+	if !ok {
+		return false, nil
+	}
+
+	used, ok := tf.recoveryCodes[string(hash)]
+	if !ok || used {
+		return false, nil
+	}
+
+	tf.recoveryCodes[string(hash)] = true
+	return true, nil
+}
+
+// twoFactorOf returns the two-factor state of the user, creating it the way
+// the columns of a fresh users row start out.
+func (s *store) twoFactorOf(userID int64) *twoFactor {
+	tf, ok := s.twoFactor[userID]
+	if !ok {
+		tf = &twoFactor{recoveryCodes: make(map[string]bool)}
+		s.twoFactor[userID] = tf
+	}
+	return tf
+}
+
+// recoveryCodes returns the recovery codes of the user, which survive a new
+// pending secret just as the rows of totp_recovery_codes do.
+func (s *store) recoveryCodes(userID int64) map[string]bool {
+	if tf, ok := s.twoFactor[userID]; ok {
+		return tf.recoveryCodes
+	}
+	return make(map[string]bool)
+}
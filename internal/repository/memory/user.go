@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"strings"
+	"time"
+)
+
+type UserRepository struct {
+	s *store
+}
+
+func (r UserRepository) Insert(ctx context.Context, user *entity.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.userWithEmail(user.Email) != nil {
+		return repository.ErrDuplicateEmail
+	}
+
+	user.ID = r.s.nextID()
+	user.CreatedAt = time.Now()
+	user.Version = 1
+
+	stored := *user
+	stored.TOTPEnabled = false
+	stored.CharacterID = entity.DefaultCharacterID
+	r.s.users[user.ID] = &stored
+
+	return nil
+}
+
+func (r UserRepository) GetUsersWithClassID(ctx context.Context, classID int64, filters repository.Filters) ([]*entity.User, repository.Metadata, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var users []*entity.User
+	for e := range r.s.enrollments {
+		if e.classID == classID {
+			user := *r.s.users[e.userID]
+			users = append(users, &user)
+		}
+	}
+
+	compare := map[string]func(a, b *entity.User) int{
+		"id":        func(a, b *entity.User) int { return 0 },
+		"username":  func(a, b *entity.User) int { return strings.Compare(a.Username, b.Username) },
+		"firstname": func(a, b *entity.User) int { return strings.Compare(a.Firstname, b.Firstname) },
+		"lastname":  func(a, b *entity.User) int { return strings.Compare(a.Lastname, b.Lastname) },
+	}
+
+	users, metadata := repository.Paginate(filters, users, func(u *entity.User) int64 { return u.ID }, compare)
+	if users == nil {
+		users = []*entity.User{}
+	}
+
+	return users, metadata, nil
+}
+
+func (r UserRepository) GetUserWithID(ctx context.Context, userID int64) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[userID]
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	user := *stored
+	return &user, nil
+}
+
+func (r UserRepository) GetUserWithEmail(ctx context.Context, email string) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored := r.s.userWithEmail(email)
+	if stored == nil {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	user := *stored
+	return &user, nil
+}
+
+func (r UserRepository) GetUserWithToken(ctx context.Context, scope, tokenPlaintext string) (*entity.User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.tokens[string(tokenHash[:])]
+	if !ok || t.Scope != scope || !t.Expiry.After(time.Now()) {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	stored, ok := r.s.users[t.UserID]
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+
+	user := *stored
+	return &user, nil
+}
+
+func (r UserRepository) Update(ctx context.Context, user *entity.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return repository.ErrEditConflict
+	}
+
+	if other := r.s.userWithEmail(user.Email); other != nil && other.ID != user.ID {
+		return repository.ErrDuplicateEmail
+	}
+
+	stored.Username = user.Username
+	stored.Firstname = user.Firstname
+	stored.Lastname = user.Lastname
+	stored.Email = user.Email
+	stored.Password.Hash = user.Password.Hash
+	stored.Role = user.Role
+	stored.Activated = user.Activated
+	stored.CharacterID = user.CharacterID
+	stored.Version++
+
+	user.Version = stored.Version
+	user.Coin = stored.Coin
+
+	return nil
+}
+
+func (r UserRepository) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return repository.ErrRecordNotFound
+	}
+
+	r.s.pendingEmails[userID] = email
+	return nil
+}
+
+func (r UserRepository) ConfirmPendingEmail(ctx context.Context, user *entity.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[user.ID]
+	email, pending := r.s.pendingEmails[user.ID]
+	if !ok || !pending {
+		return repository.ErrRecordNotFound
+	}
+
+	if other := r.s.userWithEmail(email); other != nil && other.ID != user.ID {
+		return repository.ErrDuplicateEmail
+	}
+
+	delete(r.s.pendingEmails, user.ID)
+	stored.Email = email
+	stored.Version++
+
+	user.Email = stored.Email
+	user.Version = stored.Version
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+type PermissionRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+func (r PermissionRepository) GetAllForUser(ctx context.Context, userID int64) (entity.Permissions, error) {
+	query := `SELECT permissions.code FROM permissions
+    INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+    WHERE users_permissions.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions entity.Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r PermissionRepository) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `INSERT INTO users_permissions SELECT $1, permissions.id FROM permissions
+    WHERE permissions.code = ANY($2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, userID, codes)
+	return err
+}
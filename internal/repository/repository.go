@@ -1,15 +1,154 @@
 package repository
 
-import "github.com/jackc/pgx/v5/pgxpool"
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"time"
+)
+
+// Users, Tokens, Permissions, Classes, Enrollments, Coins, Logins and
+// TwoFactor are the contracts of the repositories that have more than one
+// implementation: the Postgres one in this package and the in-memory one in
+// package memory. Both must pass the conformance suite in package
+// repositorytest, errors included. Characters is an interface as well, but
+// its in-memory implementation only keeps the users' collections.
+type Users interface {
+	Insert(ctx context.Context, user *entity.User) error
+	GetUsersWithClassID(ctx context.Context, classID int64, filters Filters) ([]*entity.User, Metadata, error)
+	GetUserWithID(ctx context.Context, userID int64) (*entity.User, error)
+	GetUserWithEmail(ctx context.Context, email string) (*entity.User, error)
+	GetUserWithToken(ctx context.Context, scope, tokenPlaintext string) (*entity.User, error)
+	Update(ctx context.Context, user *entity.User) error
+	SetPendingEmail(ctx context.Context, userID int64, email string) error
+	ConfirmPendingEmail(ctx context.Context, user *entity.User) error
+}
+
+type Tokens interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*entity.Token, error)
+	Insert(ctx context.Context, token *entity.Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	Rotate(ctx context.Context, tokenPlaintext string) (*entity.Token, error)
+	DeleteFamily(ctx context.Context, family string) error
+	DeleteFamilyOfHash(ctx context.Context, hash []byte) error
+	GetSessionsForUser(ctx context.Context, userID int64, currentHash []byte) ([]*entity.Session, error)
+	DeleteOtherSessions(ctx context.Context, userID int64, hash []byte) error
+	DeleteSessionForUser(ctx context.Context, userID int64, family string) error
+	TouchLastUsed(ctx context.Context, lastUsed map[string]time.Time) error
+	DeleteExpired(ctx context.Context, batchSize int) (int64, error)
+}
+
+type Permissions interface {
+	GetAllForUser(ctx context.Context, userID int64) (entity.Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+type Classes interface {
+	Insert(ctx context.Context, class *entity.Class) error
+	Get(ctx context.Context, id int64) (*entity.Class, error)
+	GetAll(ctx context.Context, enrolledUserID int64, filters Filters) ([]*entity.Class, Metadata, error)
+	GetWithJoinCode(ctx context.Context, code string) (*entity.Class, error)
+	SetJoinCode(ctx context.Context, classID int64, code string) error
+	Update(ctx context.Context, class *entity.Class) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type Enrollments interface {
+	Insert(ctx context.Context, userID, classID int64) error
+	Delete(ctx context.Context, userID, classID int64) error
+	Exists(ctx context.Context, userID, classID int64) (bool, error)
+}
+
+type Coins interface {
+	Apply(ctx context.Context, transaction *entity.CoinTransaction) (int64, error)
+	GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*entity.CoinTransaction, Metadata, error)
+}
+
+type Characters interface {
+	Insert(ctx context.Context, character *entity.Character) error
+	Get(ctx context.Context, id int64) (*entity.Character, error)
+	GetAll(ctx context.Context, includeRetired bool, rarity string, filters Filters) ([]*entity.Character, Metadata, error)
+	Update(ctx context.Context, character *entity.Character) error
+	Draw(ctx context.Context, userID int64, banner entity.Banner) (*entity.Character, int64, error)
+	AddForUser(ctx context.Context, userID, characterID int64) error
+	Owns(ctx context.Context, userID, characterID int64) (bool, error)
+	GetAllForUser(ctx context.Context, userID int64, rarity string, filters Filters) ([]*entity.OwnedCharacter, Metadata, error)
+	CountRaritiesForUser(ctx context.Context, userID int64) (map[string]int, error)
+}
+
+type Logins interface {
+	LockedUntil(ctx context.Context, keys ...string) (time.Time, error)
+	Record(ctx context.Context, key string, policy entity.LoginPolicy) error
+	Reset(ctx context.Context, key string) error
+	DeleteStale(ctx context.Context, batchSize int) (int64, error)
+}
+
+type TwoFactor interface {
+	SetPendingSecret(ctx context.Context, userID int64, sealedSecret []byte) error
+	GetSecret(ctx context.Context, userID int64) ([]byte, bool, error)
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+	Enable(ctx context.Context, userID int64, recoveryCodeHashes [][]byte) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error)
+}
+
+var (
+	_ Users       = UserRepository{}
+	_ Tokens      = TokenRepository{}
+	_ Permissions = PermissionRepository{}
+	_ Classes     = ClassRepository{}
+	_ Enrollments = EnrollmentRepository{}
+	_ Coins       = CoinRepository{}
+	_ Characters  = CharacterRepository{}
+	_ Logins      = LoginFailureRepository{}
+	_ TwoFactor   = TwoFactorRepository{}
+)
 
 type Repositories struct {
-	Users  UserRepository
-	Tokens TokenRepository
+	Users       Users
+	Tokens      Tokens
+	Permissions Permissions
+	Classes     Classes
+	Enrollments Enrollments
+	Coins       Coins
+	Characters  Characters
+	Logins      Logins
+	TwoFactor   TwoFactor
+	Transactor  Transactor
 }
 
-func New(db *pgxpool.Pool) Repositories {
+// New returns the Postgres repositories. Every query is cut short after
+// timeout, and transactions started through Transactor run at the given
+// isolation level.
+func New(db *pgxpool.Pool, timeout time.Duration, isolation pgx.TxIsoLevel) Repositories {
+	repositories := newRepositories(db, timeout)
+	repositories.Transactor = pgTransactor{db: db, timeout: timeout, isolation: isolation}
+
+	return repositories
+}
+
+// dbtx is what the repositories need from the database. Both the pool and a
+// transaction provide it, so the same repositories serve either.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+func newRepositories(db dbtx, timeout time.Duration) Repositories {
+	db = translatingDB{db: db}
+
 	return Repositories{
-		Users:  UserRepository{db: db},
-		Tokens: TokenRepository{db: db},
+		Users:       UserRepository{db: db, timeout: timeout},
+		Tokens:      TokenRepository{db: db, timeout: timeout},
+		Permissions: PermissionRepository{db: db, timeout: timeout},
+		Classes:     ClassRepository{db: db, timeout: timeout},
+		Enrollments: EnrollmentRepository{db: db, timeout: timeout},
+		Coins:       CoinRepository{db: db, timeout: timeout},
+		Characters:  CharacterRepository{db: db, timeout: timeout},
+		Logins:      LoginFailureRepository{db: db, timeout: timeout},
+		TwoFactor:   TwoFactorRepository{db: db, timeout: timeout},
 	}
 }
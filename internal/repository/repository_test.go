@@ -0,0 +1,96 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/migrate"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"github.com/swsd2544/learny-backend-clone/internal/repository/repositorytest"
+	"github.com/swsd2544/learny-backend-clone/migrations"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the database named by LEARNY_TEST_DB_DSN and brings
+// it up to date. Tests needing Postgres are skipped when it is not set.
+func openTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("LEARNY_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("LEARNY_TEST_DB_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, repository.New(openTestDB(t), 3*time.Second, pgx.ReadCommitted))
+}
+
+// TestConstraintErrors checks that constraint violations raised by Postgres
+// itself reach callers as the errors of package repository.
+func TestConstraintErrors(t *testing.T) {
+	ctx := context.Background()
+	repositories := repository.New(openTestDB(t), 3*time.Second, pgx.ReadCommitted)
+
+	user := &entity.User{Username: "user", Firstname: "Ada", Lastname: "Tester",
+		Email: fmt.Sprintf("constraints-%d@example.com", time.Now().UnixNano()), Role: entity.RoleStudent}
+
+	err := repositories.Users.Insert(ctx, user)
+	if !errors.Is(err, repository.ErrNotNullViolation) {
+		t.Fatalf("inserting a user without a password hash: got %v, want %v", err, repository.ErrNotNullViolation)
+	}
+
+	user.Password.Hash = []byte("not a real hash")
+	err = repositories.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repositories.Users.Insert(ctx, user)
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("inserting a duplicate email: got %v, want %v", err, repository.ErrDuplicateEmail)
+	}
+
+	err = repositories.Permissions.AddForUser(ctx, math.MaxInt64, entity.PermissionClassesRead)
+	if !errors.Is(err, repository.ErrMissingReference) {
+		t.Fatalf("adding permissions to a missing user: got %v, want %v", err, repository.ErrMissingReference)
+	}
+
+	_, err = repositories.Coins.Apply(ctx, &entity.CoinTransaction{UserID: user.ID, Delta: 0, Reason: "nothing"})
+	if !errors.Is(err, repository.ErrCheckViolation) {
+		t.Fatalf("applying a zero coin transaction: got %v, want %v", err, repository.ErrCheckViolation)
+	}
+
+	err = repositories.Transactor.WithinTx(ctx, func(tx repository.Repositories) error {
+		return tx.Users.Insert(ctx, user)
+	})
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("inserting a duplicate email in a transaction: got %v, want %v", err, repository.ErrDuplicateEmail)
+	}
+}
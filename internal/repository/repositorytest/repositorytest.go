@@ -0,0 +1,711 @@
+// Package repositorytest is the conformance suite for implementations of the
+// repository interfaces. Every implementation runs it against a fresh set of
+// repositories; it only adds data, so it also runs against a database that
+// already holds some.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/swsd2544/learny-backend-clone/internal/entity"
+	"github.com/swsd2544/learny-backend-clone/internal/repository"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Run runs the whole suite against repositories.
+func Run(t *testing.T, repositories repository.Repositories) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, repositories) })
+	t.Run("PendingEmail", func(t *testing.T) { testPendingEmail(t, repositories) })
+	t.Run("Tokens", func(t *testing.T) { testTokens(t, repositories) })
+	t.Run("Permissions", func(t *testing.T) { testPermissions(t, repositories) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, repositories) })
+	t.Run("Classes", func(t *testing.T) { testClasses(t, repositories) })
+	t.Run("Enrollments", func(t *testing.T) { testEnrollments(t, repositories) })
+	t.Run("Coins", func(t *testing.T) { testCoins(t, repositories) })
+	t.Run("CharacterCollections", func(t *testing.T) { testCharacterCollections(t, repositories) })
+	t.Run("Logins", func(t *testing.T) { testLogins(t, repositories) })
+	t.Run("TwoFactor", func(t *testing.T) { testTwoFactor(t, repositories) })
+	t.Run("Transactor", func(t *testing.T) { testTransactor(t, repositories) })
+}
+
+var sequence atomic.Int64
+
+// uniqueEmail returns an address no earlier run of the suite has used.
+func uniqueEmail() string {
+	return fmt.Sprintf("conformance-%d-%d@example.com", time.Now().UnixNano(), sequence.Add(1))
+}
+
+func insertUser(t *testing.T, repositories repository.Repositories, firstname string) *entity.User {
+	t.Helper()
+
+	ctx := context.Background()
+
+	user := &entity.User{
+		Username:    "user",
+		Firstname:   firstname,
+		Lastname:    "Tester",
+		Email:       uniqueEmail(),
+		Role:        entity.RoleStudent,
+		CharacterID: entity.DefaultCharacterID,
+	}
+	user.Password.Hash = []byte("not a real hash")
+
+	err := repositories.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+
+	return user
+}
+
+func insertToken(t *testing.T, repositories repository.Repositories, userID int64, ttl time.Duration, scope, family string) *entity.Token {
+	t.Helper()
+
+	ctx := context.Background()
+
+	token, err := entity.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Family = family
+
+	err = repositories.Tokens.Insert(ctx, token)
+	if err != nil {
+		t.Fatalf("inserting token: %v", err)
+	}
+
+	return token
+}
+
+func insertClass(t *testing.T, repositories repository.Repositories, teacherID int64) *entity.Class {
+	t.Helper()
+
+	ctx := context.Background()
+
+	class := &entity.Class{Name: "Conformance", Description: "A class", TeacherID: teacherID}
+
+	err := repositories.Classes.Insert(ctx, class)
+	if err != nil {
+		t.Fatalf("inserting class: %v", err)
+	}
+
+	return class
+}
+
+func expectError(t *testing.T, err, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("got error %v, want %v", err, target)
+	}
+}
+
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func testUsers(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+	if user.ID == 0 || user.Version != 1 || user.CreatedAt.IsZero() {
+		t.Fatalf("insert did not set id, version and created_at: %+v", user)
+	}
+
+	got, err := repositories.Users.GetUserWithID(ctx, user.ID)
+	expectNoError(t, err)
+	if got.Email != user.Email || got.Firstname != "Ada" || got.Role != entity.RoleStudent {
+		t.Fatalf("got %+v, want %+v", got, user)
+	}
+
+	got, err = repositories.Users.GetUserWithEmail(ctx, strings.ToUpper(user.Email))
+	expectNoError(t, err)
+	if got.ID != user.ID {
+		t.Fatalf("email lookup is not case-insensitive: got user %d, want %d", got.ID, user.ID)
+	}
+
+	_, err = repositories.Users.GetUserWithID(ctx, math.MaxInt64)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	_, err = repositories.Users.GetUserWithEmail(ctx, uniqueEmail())
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	duplicate := &entity.User{Username: "user", Firstname: "Eve", Lastname: "Tester",
+		Email: strings.ToUpper(user.Email), Role: entity.RoleStudent}
+	duplicate.Password.Hash = []byte("not a real hash")
+	expectError(t, repositories.Users.Insert(ctx, duplicate), repository.ErrDuplicateEmail)
+
+	stale := *got
+	got.Firstname = "Grace"
+	expectNoError(t, repositories.Users.Update(ctx, got))
+	if got.Version != 2 {
+		t.Fatalf("got version %d after update, want 2", got.Version)
+	}
+
+	stale.Lastname = "Lovelace"
+	expectError(t, repositories.Users.Update(ctx, &stale), repository.ErrEditConflict)
+
+	other := insertUser(t, repositories, "Alan")
+	other.Email = user.Email
+	expectError(t, repositories.Users.Update(ctx, other), repository.ErrDuplicateEmail)
+
+	got, err = repositories.Users.GetUserWithID(ctx, user.ID)
+	expectNoError(t, err)
+	if got.Firstname != "Grace" || got.Lastname != "Tester" {
+		t.Fatalf("got %s %s, want Grace Tester", got.Firstname, got.Lastname)
+	}
+}
+
+func testPendingEmail(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+	email := uniqueEmail()
+
+	expectError(t, repositories.Users.ConfirmPendingEmail(ctx, user), repository.ErrRecordNotFound)
+	expectError(t, repositories.Users.SetPendingEmail(ctx, math.MaxInt64, email), repository.ErrRecordNotFound)
+
+	expectNoError(t, repositories.Users.SetPendingEmail(ctx, user.ID, email))
+
+	got, err := repositories.Users.GetUserWithEmail(ctx, email)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	expectNoError(t, repositories.Users.ConfirmPendingEmail(ctx, user))
+	if user.Email != email || user.Version != 2 {
+		t.Fatalf("got email %s version %d, want %s version 2", user.Email, user.Version, email)
+	}
+
+	got, err = repositories.Users.GetUserWithEmail(ctx, email)
+	expectNoError(t, err)
+	if got.ID != user.ID {
+		t.Fatalf("got user %d, want %d", got.ID, user.ID)
+	}
+
+	expectError(t, repositories.Users.ConfirmPendingEmail(ctx, user), repository.ErrRecordNotFound)
+
+	other := insertUser(t, repositories, "Alan")
+	expectNoError(t, repositories.Users.SetPendingEmail(ctx, other.ID, email))
+	expectError(t, repositories.Users.ConfirmPendingEmail(ctx, other), repository.ErrDuplicateEmail)
+}
+
+func testTokens(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+
+	token, err := repositories.Tokens.New(ctx, user.ID, time.Hour, entity.ScopeAuthentication)
+	expectNoError(t, err)
+
+	got, err := repositories.Users.GetUserWithToken(ctx, entity.ScopeAuthentication, token.Plaintext)
+	expectNoError(t, err)
+	if got.ID != user.ID {
+		t.Fatalf("got user %d, want %d", got.ID, user.ID)
+	}
+
+	_, err = repositories.Users.GetUserWithToken(ctx, entity.ScopeActivation, token.Plaintext)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	missing, err := entity.GenerateToken(math.MaxInt64, time.Hour, entity.ScopeAuthentication)
+	expectNoError(t, err)
+	expectError(t, repositories.Tokens.Insert(ctx, missing), repository.ErrRecordNotFound)
+
+	expired := insertToken(t, repositories, user.ID, -time.Hour, entity.ScopeAuthentication, "")
+	_, err = repositories.Users.GetUserWithToken(ctx, entity.ScopeAuthentication, expired.Plaintext)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	deleted, err := repositories.Tokens.DeleteExpired(ctx, math.MaxInt32)
+	expectNoError(t, err)
+	if deleted < 1 {
+		t.Fatalf("got %d expired tokens deleted, want at least 1", deleted)
+	}
+
+	expectNoError(t, repositories.Tokens.DeleteAllForUser(ctx, entity.ScopeAuthentication, user.ID))
+	_, err = repositories.Users.GetUserWithToken(ctx, entity.ScopeAuthentication, token.Plaintext)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	refresh := insertToken(t, repositories, user.ID, time.Hour, entity.ScopeRefresh, "family-"+uniqueEmail())
+
+	rotated, err := repositories.Tokens.Rotate(ctx, refresh.Plaintext)
+	expectNoError(t, err)
+	if rotated.UserID != user.ID || rotated.Family != refresh.Family {
+		t.Fatalf("got rotated token %+v, want user %d family %s", rotated, user.ID, refresh.Family)
+	}
+
+	rotated, err = repositories.Tokens.Rotate(ctx, refresh.Plaintext)
+	expectError(t, err, repository.ErrTokenReused)
+	if rotated == nil || rotated.Family != refresh.Family {
+		t.Fatalf("reuse did not return the token family: %+v", rotated)
+	}
+
+	_, err = repositories.Tokens.Rotate(ctx, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	access := insertToken(t, repositories, user.ID, time.Hour, entity.ScopeAuthentication, refresh.Family)
+	expectNoError(t, repositories.Tokens.DeleteFamily(ctx, refresh.Family))
+	_, err = repositories.Users.GetUserWithToken(ctx, entity.ScopeAuthentication, access.Plaintext)
+	expectError(t, err, repository.ErrRecordNotFound)
+}
+
+func testSessions(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+	other := insertUser(t, repositories, "Alan")
+
+	newSession := func() (*entity.Token, *entity.Token) {
+		family, err := entity.NewTokenFamily()
+		expectNoError(t, err)
+
+		access := insertToken(t, repositories, user.ID, time.Hour, entity.ScopeAuthentication, family)
+		refresh := insertToken(t, repositories, user.ID, 24*time.Hour, entity.ScopeRefresh, family)
+		return access, refresh
+	}
+
+	first, _ := newSession()
+	second, _ := newSession()
+	third, _ := newSession()
+
+	expectNoError(t, repositories.Tokens.TouchLastUsed(ctx, map[string]time.Time{
+		string(second.Hash): time.Now(),
+	}))
+
+	sessions, err := repositories.Tokens.GetSessionsForUser(ctx, user.ID, first.Hash)
+	expectNoError(t, err)
+	if len(sessions) != 3 {
+		t.Fatalf("got %d sessions, want 3", len(sessions))
+	}
+	if sessions[0].ID != second.Family || sessions[0].LastUsedAt == nil {
+		t.Fatalf("most recently used session is not listed first: %+v", sessions[0])
+	}
+	for _, session := range sessions {
+		if session.Current != (session.ID == first.Family) {
+			t.Fatalf("session %s has current = %t", session.ID, session.Current)
+		}
+	}
+
+	expectError(t, repositories.Tokens.DeleteSessionForUser(ctx, other.ID, first.Family), repository.ErrRecordNotFound)
+	expectNoError(t, repositories.Tokens.DeleteSessionForUser(ctx, user.ID, third.Family))
+	expectError(t, repositories.Tokens.DeleteSessionForUser(ctx, user.ID, third.Family), repository.ErrRecordNotFound)
+
+	expectNoError(t, repositories.Tokens.DeleteOtherSessions(ctx, user.ID, first.Hash))
+
+	sessions, err = repositories.Tokens.GetSessionsForUser(ctx, user.ID, first.Hash)
+	expectNoError(t, err)
+	if len(sessions) != 1 || sessions[0].ID != first.Family {
+		t.Fatalf("got %d sessions after signing out the others, want only %s", len(sessions), first.Family)
+	}
+
+	expectNoError(t, repositories.Tokens.DeleteFamilyOfHash(ctx, first.Hash))
+
+	sessions, err = repositories.Tokens.GetSessionsForUser(ctx, user.ID, nil)
+	expectNoError(t, err)
+	if len(sessions) != 0 {
+		t.Fatalf("got %d sessions after signing out, want 0", len(sessions))
+	}
+}
+
+func testPermissions(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+
+	permissions, err := repositories.Permissions.GetAllForUser(ctx, user.ID)
+	expectNoError(t, err)
+	if len(permissions) != 0 {
+		t.Fatalf("got permissions %v for a new user, want none", permissions)
+	}
+
+	err = repositories.Permissions.AddForUser(ctx, user.ID, entity.PermissionClassesRead, "unknown:code")
+	expectNoError(t, err)
+	err = repositories.Permissions.AddForUser(ctx, user.ID, entity.PermissionClassesRead, entity.PermissionUsersManage)
+	expectNoError(t, err)
+
+	permissions, err = repositories.Permissions.GetAllForUser(ctx, user.ID)
+	expectNoError(t, err)
+	if len(permissions) != 2 || !permissions.Include(entity.PermissionClassesRead) || !permissions.Include(entity.PermissionUsersManage) {
+		t.Fatalf("got permissions %v, want classes:read and users:manage", permissions)
+	}
+
+	err = repositories.Permissions.AddForUser(ctx, math.MaxInt64, entity.PermissionClassesRead)
+	expectError(t, err, repository.ErrMissingReference)
+}
+
+func testClasses(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	teacher := insertUser(t, repositories, "Ada")
+	class := insertClass(t, repositories, teacher.ID)
+	if class.ID == 0 || class.Version != 1 {
+		t.Fatalf("insert did not set id and version: %+v", class)
+	}
+
+	got, err := repositories.Classes.Get(ctx, class.ID)
+	expectNoError(t, err)
+	if got.Name != class.Name || got.TeacherID != teacher.ID {
+		t.Fatalf("got %+v, want %+v", got, class)
+	}
+
+	_, err = repositories.Classes.Get(ctx, math.MaxInt64)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	stale := *got
+	got.Name = "Renamed"
+	expectNoError(t, repositories.Classes.Update(ctx, got))
+	expectError(t, repositories.Classes.Update(ctx, &stale), repository.ErrEditConflict)
+
+	code, err := entity.GenerateJoinCode()
+	expectNoError(t, err)
+
+	_, err = repositories.Classes.GetWithJoinCode(ctx, code)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	expectNoError(t, repositories.Classes.SetJoinCode(ctx, class.ID, code))
+	expectError(t, repositories.Classes.SetJoinCode(ctx, math.MaxInt64, code), repository.ErrRecordNotFound)
+
+	got, err = repositories.Classes.GetWithJoinCode(ctx, code)
+	expectNoError(t, err)
+	if got.ID != class.ID || got.Name != "Renamed" {
+		t.Fatalf("got %+v for the join code, want class %d", got, class.ID)
+	}
+
+	expectNoError(t, repositories.Classes.Delete(ctx, class.ID))
+	expectError(t, repositories.Classes.Delete(ctx, class.ID), repository.ErrRecordNotFound)
+
+	_, err = repositories.Classes.Get(ctx, class.ID)
+	expectError(t, err, repository.ErrRecordNotFound)
+}
+
+func testEnrollments(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	teacher := insertUser(t, repositories, "Teacher")
+	class := insertClass(t, repositories, teacher.ID)
+	otherClass := insertClass(t, repositories, teacher.ID)
+
+	students := []*entity.User{
+		insertUser(t, repositories, "Carol"),
+		insertUser(t, repositories, "Alice"),
+		insertUser(t, repositories, "Bob"),
+	}
+	for _, student := range students {
+		expectNoError(t, repositories.Enrollments.Insert(ctx, student.ID, class.ID))
+	}
+
+	expectError(t, repositories.Enrollments.Insert(ctx, students[0].ID, class.ID), repository.ErrAlreadyEnrolled)
+	expectError(t, repositories.Enrollments.Insert(ctx, students[0].ID, math.MaxInt64), repository.ErrRecordNotFound)
+
+	enrolled, err := repositories.Enrollments.Exists(ctx, students[0].ID, class.ID)
+	expectNoError(t, err)
+	if !enrolled {
+		t.Fatal("enrolled student is not reported as enrolled")
+	}
+
+	enrolled, err = repositories.Enrollments.Exists(ctx, students[0].ID, otherClass.ID)
+	expectNoError(t, err)
+	if enrolled {
+		t.Fatal("student is reported as enrolled in a class they did not join")
+	}
+
+	filters := repository.Filters{Page: 1, PageSize: 2, Sort: "firstname", SortSafelist: []string{"id", "firstname"}}
+
+	page, metadata, err := repositories.Users.GetUsersWithClassID(ctx, class.ID, filters)
+	expectNoError(t, err)
+	if len(page) != 2 || page[0].Firstname != "Alice" || page[1].Firstname != "Bob" {
+		t.Fatalf("got first page %v, want Alice and Bob", firstnames(page))
+	}
+	if metadata.TotalRecords != 3 || metadata.LastPage != 2 || metadata.NextCursor != page[1].ID {
+		t.Fatalf("got metadata %+v for the first page", metadata)
+	}
+
+	filters.After = metadata.NextCursor
+	page, metadata, err = repositories.Users.GetUsersWithClassID(ctx, class.ID, filters)
+	expectNoError(t, err)
+	if len(page) != 1 || page[0].Firstname != "Carol" || metadata.NextCursor != 0 {
+		t.Fatalf("got page %v and metadata %+v after the cursor, want Carol only", firstnames(page), metadata)
+	}
+
+	filters = repository.Filters{Page: 1, PageSize: 10, Sort: "id", SortSafelist: []string{"id"}}
+
+	classes, _, err := repositories.Classes.GetAll(ctx, students[1].ID, filters)
+	expectNoError(t, err)
+	if len(classes) != 1 || classes[0].ID != class.ID {
+		t.Fatalf("got %d classes for an enrolled student, want class %d", len(classes), class.ID)
+	}
+
+	expectNoError(t, repositories.Enrollments.Delete(ctx, students[1].ID, class.ID))
+	expectError(t, repositories.Enrollments.Delete(ctx, students[1].ID, class.ID), repository.ErrRecordNotFound)
+
+	classes, _, err = repositories.Classes.GetAll(ctx, students[1].ID, filters)
+	expectNoError(t, err)
+	if len(classes) != 0 {
+		t.Fatalf("got %d classes after leaving, want 0", len(classes))
+	}
+}
+
+func firstnames(users []*entity.User) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.Firstname
+	}
+	return names
+}
+
+func testCoins(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+
+	balance, err := repositories.Coins.Apply(ctx, &entity.CoinTransaction{UserID: user.ID, Delta: 100, Reason: "grant"})
+	expectNoError(t, err)
+	if balance != 100 {
+		t.Fatalf("got balance %d, want 100", balance)
+	}
+
+	_, err = repositories.Coins.Apply(ctx, &entity.CoinTransaction{UserID: user.ID, Delta: -150, Reason: "spend"})
+	expectError(t, err, repository.ErrInsufficientCoins)
+
+	_, err = repositories.Coins.Apply(ctx, &entity.CoinTransaction{UserID: math.MaxInt64, Delta: 100, Reason: "grant"})
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	first := &entity.CoinTransaction{UserID: user.ID, Delta: -30, Reason: "spend", IdempotencyKey: "key"}
+	balance, err = repositories.Coins.Apply(ctx, first)
+	expectNoError(t, err)
+	if balance != 70 {
+		t.Fatalf("got balance %d, want 70", balance)
+	}
+
+	retry := &entity.CoinTransaction{UserID: user.ID, Delta: -30, Reason: "spend", IdempotencyKey: "key"}
+	balance, err = repositories.Coins.Apply(ctx, retry)
+	expectNoError(t, err)
+	if balance != 70 || retry.ID != first.ID {
+		t.Fatalf("retry applied again: balance %d, transaction %d, want 70 and %d", balance, retry.ID, first.ID)
+	}
+
+	got, err := repositories.Users.GetUserWithID(ctx, user.ID)
+	expectNoError(t, err)
+	if got.Coin != 70 {
+		t.Fatalf("got %d coins on the user, want 70", got.Coin)
+	}
+
+	filters := repository.Filters{Page: 1, PageSize: 10, Sort: "-id", SortSafelist: []string{"id", "-id"}}
+
+	transactions, metadata, err := repositories.Coins.GetAllForUser(ctx, user.ID, filters)
+	expectNoError(t, err)
+	if len(transactions) != 2 || transactions[0].ID != first.ID || metadata.TotalRecords != 2 {
+		t.Fatalf("got %d transactions with metadata %+v, want 2 newest first", len(transactions), metadata)
+	}
+
+	missingClassID := int64(math.MaxInt64)
+	_, err = repositories.Coins.Apply(ctx, &entity.CoinTransaction{UserID: user.ID, Delta: 10, Reason: "grant", ClassID: &missingClassID})
+	expectError(t, err, repository.ErrMissingReference)
+
+	teacher := insertUser(t, repositories, "Alan")
+	class := insertClass(t, repositories, teacher.ID)
+
+	granted := &entity.CoinTransaction{UserID: user.ID, Delta: 10, Reason: "grant", ActorID: &teacher.ID, ClassID: &class.ID}
+	_, err = repositories.Coins.Apply(ctx, granted)
+	expectNoError(t, err)
+
+	expectNoError(t, repositories.Classes.Delete(ctx, class.ID))
+
+	transactions, _, err = repositories.Coins.GetAllForUser(ctx, user.ID, filters)
+	expectNoError(t, err)
+	if transactions[0].ID != granted.ID || transactions[0].ClassID != nil || transactions[0].Delta != 10 {
+		t.Fatalf("got %+v after deleting the class, want the grant without its class", transactions[0])
+	}
+}
+
+func testCharacterCollections(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+
+	owns, err := repositories.Characters.Owns(ctx, user.ID, entity.DefaultCharacterID)
+	expectNoError(t, err)
+	if owns {
+		t.Fatal("a new user owns the default character before it was added")
+	}
+
+	for i := 0; i < 2; i++ {
+		err = repositories.Characters.AddForUser(ctx, user.ID, entity.DefaultCharacterID)
+		expectNoError(t, err)
+	}
+
+	owns, err = repositories.Characters.Owns(ctx, user.ID, entity.DefaultCharacterID)
+	expectNoError(t, err)
+	if !owns {
+		t.Fatal("the added character is not owned")
+	}
+
+	err = repositories.Characters.AddForUser(ctx, math.MaxInt64, entity.DefaultCharacterID)
+	expectError(t, err, repository.ErrMissingReference)
+}
+
+func testLogins(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	policy := entity.LoginPolicy{FreeAttempts: 1, MaxAttempts: 3, BaseDelay: time.Minute, Lockout: time.Hour, Window: time.Hour}
+	key, other := "conformance:"+uniqueEmail(), "conformance:"+uniqueEmail()
+
+	// lockedFor returns how much longer the keys are locked. Locks are kept
+	// in whole seconds, so a free attempt may leave one of under a second.
+	lockedFor := func(keys ...string) time.Duration {
+		t.Helper()
+
+		lockedUntil, err := repositories.Logins.LockedUntil(ctx, keys...)
+		expectNoError(t, err)
+		if lockedUntil.IsZero() {
+			return 0
+		}
+		return time.Until(lockedUntil)
+	}
+
+	if locked := lockedFor(key, other); locked > 0 {
+		t.Fatalf("got a fresh key locked for %v", locked)
+	}
+
+	expectNoError(t, repositories.Logins.Record(ctx, key, policy))
+
+	if locked := lockedFor(key, other); locked > time.Second {
+		t.Fatalf("got a key locked for %v after a free attempt", locked)
+	}
+
+	expectNoError(t, repositories.Logins.Record(ctx, key, policy))
+
+	if locked := lockedFor(other, key); locked <= time.Second || locked > time.Minute {
+		t.Fatalf("got the key locked for %v after two failures, want up to a minute", locked)
+	}
+
+	expectNoError(t, repositories.Logins.Record(ctx, key, policy))
+
+	if locked := lockedFor(key); locked <= time.Minute || locked > time.Hour {
+		t.Fatalf("got the key locked for %v after three failures, want the lockout", locked)
+	}
+
+	expectNoError(t, repositories.Logins.Reset(ctx, key))
+
+	if locked := lockedFor(key); locked > 0 {
+		t.Fatalf("got a reset key locked for %v", locked)
+	}
+
+	// A policy whose lock and window lie in the past leaves a stale row.
+	past := entity.LoginPolicy{MaxAttempts: 1, Lockout: -time.Hour, Window: -time.Hour}
+	expectNoError(t, repositories.Logins.Record(ctx, other, past))
+	expectNoError(t, repositories.Logins.Record(ctx, key, policy))
+
+	for {
+		deleted, err := repositories.Logins.DeleteStale(ctx, 100)
+		expectNoError(t, err)
+		if deleted < 100 {
+			break
+		}
+	}
+
+	// A second failure locks a key only if the first one is still counted.
+	expectNoError(t, repositories.Logins.Record(ctx, key, policy))
+	expectNoError(t, repositories.Logins.Record(ctx, other, policy))
+
+	if locked := lockedFor(key); locked <= time.Second {
+		t.Fatal("a failure within the window was deleted")
+	}
+
+	if locked := lockedFor(other); locked > time.Second {
+		t.Fatal("a stale failure was not deleted")
+	}
+}
+
+func testTwoFactor(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	user := insertUser(t, repositories, "Ada")
+
+	_, _, err := repositories.TwoFactor.GetSecret(ctx, user.ID)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	expectNoError(t, repositories.TwoFactor.SetPendingSecret(ctx, user.ID, []byte("sealed")))
+
+	secret, enabled, err := repositories.TwoFactor.GetSecret(ctx, user.ID)
+	expectNoError(t, err)
+	if string(secret) != "sealed" || enabled {
+		t.Fatalf("got secret %q, enabled %t, want the pending secret", secret, enabled)
+	}
+
+	for _, tt := range []struct {
+		step int64
+		want bool
+	}{{10, true}, {10, false}, {9, false}, {11, true}} {
+		ok, err := repositories.TwoFactor.UseStep(ctx, user.ID, tt.step)
+		expectNoError(t, err)
+		if ok != tt.want {
+			t.Fatalf("using step %d: got %t, want %t", tt.step, ok, tt.want)
+		}
+	}
+
+	code := entity.HashRecoveryCode(uniqueEmail())
+	expectNoError(t, repositories.TwoFactor.Enable(ctx, user.ID, [][]byte{code}))
+
+	err = repositories.TwoFactor.Enable(ctx, user.ID, [][]byte{entity.HashRecoveryCode(uniqueEmail())})
+	expectError(t, err, repository.ErrEditConflict)
+
+	err = repositories.TwoFactor.SetPendingSecret(ctx, user.ID, []byte("other"))
+	expectError(t, err, repository.ErrEditConflict)
+
+	got, err := repositories.Users.GetUserWithID(ctx, user.ID)
+	expectNoError(t, err)
+	if !got.TOTPEnabled || got.Version != user.Version+1 {
+		t.Fatalf("got totp_enabled %t and version %d, want true and %d", got.TOTPEnabled, got.Version, user.Version+1)
+	}
+
+	for _, want := range []bool{true, false} {
+		ok, err := repositories.TwoFactor.UseRecoveryCode(ctx, user.ID, code)
+		expectNoError(t, err)
+		if ok != want {
+			t.Fatalf("using the recovery code: got %t, want %t", ok, want)
+		}
+	}
+}
+
+func testTransactor(t *testing.T, repositories repository.Repositories) {
+	ctx := context.Background()
+
+	failure := errors.New("failure")
+	var rolledBack *entity.User
+
+	err := repositories.Transactor.WithinTx(ctx, func(tx repository.Repositories) error {
+		rolledBack = insertUser(t, tx, "Ada")
+		insertToken(t, tx, rolledBack.ID, time.Hour, entity.ScopeActivation, "")
+		return failure
+	})
+	expectError(t, err, failure)
+
+	_, err = repositories.Users.GetUserWithEmail(ctx, rolledBack.Email)
+	expectError(t, err, repository.ErrRecordNotFound)
+
+	var committed *entity.User
+	var token *entity.Token
+
+	err = repositories.Transactor.WithinTx(ctx, func(tx repository.Repositories) error {
+		committed = insertUser(t, tx, "Alan")
+
+		return tx.Transactor.WithinTx(ctx, func(tx repository.Repositories) error {
+			token = insertToken(t, tx, committed.ID, time.Hour, entity.ScopeActivation, "")
+			return nil
+		})
+	})
+	expectNoError(t, err)
+
+	got, err := repositories.Users.GetUserWithToken(ctx, entity.ScopeActivation, token.Plaintext)
+	expectNoError(t, err)
+	if got.ID != committed.ID {
+		t.Fatalf("got user %d, want %d", got.ID, committed.ID)
+	}
+}
@@ -2,42 +2,225 @@ package repository
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"crypto/sha256"
+	"errors"
+	"github.com/jackc/pgx/v5"
 	"github.com/swsd2544/learny-backend-clone/internal/entity"
 	"time"
 )
 
+var (
+	ErrTokenReused = errors.New("token reused")
+)
+
 type TokenRepository struct {
-	db *pgxpool.Pool
+	db      dbtx
+	timeout time.Duration
 }
 
-func (r TokenRepository) New(userID int64, ttl time.Duration, scope string) (*entity.Token, error) {
+func (r TokenRepository) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*entity.Token, error) {
 	token, err := entity.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = r.Insert(token)
+	err = r.Insert(ctx, token)
 	return token, err
 }
 
-func (r TokenRepository) Insert(token *entity.Token) error {
-	query := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES ($1, $2, $3, $4)`
+func (r TokenRepository) Insert(ctx context.Context, token *entity.Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, family, user_agent, ip)
+    VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7) RETURNING id, created_at`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family, token.UserAgent, token.IP}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
-	_, err := r.db.Exec(ctx, query, args...)
-	return err
+	return r.db.QueryRow(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
 }
 
-func (r TokenRepository) DeleteAllForUser(scope string, userID int64) error {
+func (r TokenRepository) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `DELETE FROM tokens WHERE scope=$1 AND user_id=$2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	_, err := r.db.Exec(ctx, query, scope, userID)
 	return err
 }
+
+// Rotate marks the refresh token as used and returns it. A token can only be
+// rotated once: presenting it again returns the token together with
+// ErrTokenReused, so that the caller can revoke its whole family.
+func (r TokenRepository) Rotate(ctx context.Context, tokenPlaintext string) (*entity.Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `UPDATE tokens SET rotated_at = NOW()
+    WHERE hash = $1 AND scope = $2 AND expiry > NOW() AND rotated_at IS NULL
+    RETURNING user_id, expiry, COALESCE(family, '')`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	token := entity.Token{
+		Plaintext: tokenPlaintext,
+		Hash:      tokenHash[:],
+		Scope:     entity.ScopeRefresh,
+	}
+	err := r.db.QueryRow(ctx, query, token.Hash, token.Scope).Scan(&token.UserID, &token.Expiry, &token.Family)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	query = `SELECT user_id, expiry, COALESCE(family, '') FROM tokens
+    WHERE hash = $1 AND scope = $2 AND expiry > NOW()`
+
+	err = r.db.QueryRow(ctx, query, token.Hash, token.Scope).Scan(&token.UserID, &token.Expiry, &token.Family)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &token, ErrTokenReused
+}
+
+// DeleteFamily revokes every token, of any scope, belonging to the family.
+func (r TokenRepository) DeleteFamily(ctx context.Context, family string) error {
+	query := `DELETE FROM tokens WHERE family = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, family)
+	return err
+}
+
+// DeleteFamilyOfHash revokes the token with the given hash together with
+// every other token of its family.
+func (r TokenRepository) DeleteFamilyOfHash(ctx context.Context, hash []byte) error {
+	query := `DELETE FROM tokens WHERE hash = $1
+    OR family = (SELECT family FROM tokens WHERE hash = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, hash)
+	return err
+}
+
+// GetSessionsForUser lists the user's logged in devices, that is every token
+// family that still holds a usable refresh token. currentHash marks the
+// session the request was made with.
+func (r TokenRepository) GetSessionsForUser(ctx context.Context, userID int64, currentHash []byte) ([]*entity.Session, error) {
+	query := `SELECT family, min(created_at), max(last_used_at), max(expiry),
+    (array_agg(user_agent ORDER BY id DESC))[1], (array_agg(ip ORDER BY id DESC))[1], bool_or(hash = $2)
+    FROM tokens WHERE user_id = $1 AND family IS NOT NULL AND expiry > NOW()
+    GROUP BY family HAVING bool_or(scope = $3 AND rotated_at IS NULL)
+    ORDER BY max(last_used_at) DESC NULLS LAST, min(created_at) DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, userID, currentHash, entity.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*entity.Session{}
+	for rows.Next() {
+		var session entity.Session
+		err := rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.Expiry,
+			&session.UserAgent, &session.IP, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteOtherSessions signs the user out everywhere except in the session
+// the token with the given hash belongs to.
+func (r TokenRepository) DeleteOtherSessions(ctx context.Context, userID int64, hash []byte) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND scope = ANY($2)
+    AND family IS DISTINCT FROM (SELECT family FROM tokens WHERE hash = $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	scopes := []string{entity.ScopeAuthentication, entity.ScopeRefresh}
+
+	_, err := r.db.Exec(ctx, query, userID, scopes, hash)
+	return err
+}
+
+// DeleteSessionForUser revokes every token of the session, but only when it
+// belongs to the user.
+func (r TokenRepository) DeleteSessionForUser(ctx context.Context, userID int64, family string) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND family = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, userID, family)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// TouchLastUsed records when each token, keyed by its hash, was last used.
+func (r TokenRepository) TouchLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	hashes := make([][]byte, 0, len(lastUsed))
+	times := make([]time.Time, 0, len(lastUsed))
+	for hash, t := range lastUsed {
+		hashes = append(hashes, []byte(hash))
+		times = append(times, t)
+	}
+
+	query := `UPDATE tokens SET last_used_at = v.last_used_at
+    FROM unnest($1::bytea[], $2::timestamptz[]) AS v(hash, last_used_at)
+    WHERE tokens.hash = v.hash`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, query, hashes, times)
+	return err
+}
+
+// DeleteExpired deletes at most batchSize expired tokens and reports how many
+// were deleted. Callers wanting everything gone keep calling it until it
+// returns fewer than batchSize.
+func (r TokenRepository) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	query := `DELETE FROM tokens WHERE hash IN (
+    SELECT hash FROM tokens WHERE expiry <= NOW() LIMIT $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
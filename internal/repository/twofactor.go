@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+type TwoFactorRepository struct {
+	db      dbtx
+	timeout time.Duration
+}
+
+// SetPendingSecret stores a new, already encrypted, secret for a user who
+// has not enabled two-factor authentication yet. It replaces any earlier
+// unconfirmed secret and returns ErrEditConflict when 2FA is already enabled.
+func (r TwoFactorRepository) SetPendingSecret(ctx context.Context, userID int64, sealedSecret []byte) error {
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = 0
+    WHERE id = $2 AND NOT totp_enabled`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, sealedSecret, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// GetSecret returns the encrypted secret of the user and whether it has been
+// confirmed. ErrRecordNotFound means the user never started enrollment.
+func (r TwoFactorRepository) GetSecret(ctx context.Context, userID int64) ([]byte, bool, error) {
+	query := `SELECT totp_secret, totp_enabled FROM users WHERE id = $1 AND totp_secret IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var sealedSecret []byte
+	var enabled bool
+	err := r.db.QueryRow(ctx, query, userID).Scan(&sealedSecret, &enabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, false, ErrRecordNotFound
+		default:
+			return nil, false, err
+		}
+	}
+
+	return sealedSecret, enabled, nil
+}
+
+// UseStep records that a code of the given time step was accepted. It
+// returns false when a code of that step or a later one was accepted before,
+// so every code works only once.
+func (r TwoFactorRepository) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// Enable turns two-factor authentication on and replaces the user's recovery
+// codes with the given hashes. It returns ErrEditConflict when 2FA is already
+// enabled, so a second confirmation cannot replace codes the user was shown.
+func (r TwoFactorRepository) Enable(ctx context.Context, userID int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET totp_enabled = true, version = version + 1
+    WHERE id = $1 AND NOT totp_enabled`
+
+	result, err := tx.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO totp_recovery_codes (hash, user_id) SELECT unnest($1::bytea[]), $2`
+
+	_, err = tx.Exec(ctx, query, recoveryCodeHashes, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseRecoveryCode marks the recovery code with the given hash as used and
+// reports whether it was a valid, unused code of the user.
+func (r TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	query := `UPDATE totp_recovery_codes SET used_at = NOW()
+    WHERE hash = $1 AND user_id = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, hash, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() == 1, nil
+}
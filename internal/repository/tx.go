@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// Transactor runs fn with repositories that share one transaction, so that
+// changes spanning several repositories commit or roll back together. The
+// transaction commits when fn returns nil. fn may be run more than once and
+// must not have effects outside the repositories it is given.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(Repositories) error) error
+}
+
+// maxTxAttempts bounds how often a transaction is run when it keeps failing
+// with a serialization failure.
+const maxTxAttempts = 3
+
+type pgTransactor struct {
+	db        *pgxpool.Pool
+	timeout   time.Duration
+	isolation pgx.TxIsoLevel
+}
+
+func (t pgTransactor) WithinTx(ctx context.Context, fn func(Repositories) error) error {
+	var err error
+
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = t.run(ctx, fn)
+		if !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+
+	return err
+}
+
+func (t pgTransactor) run(ctx context.Context, fn func(Repositories) error) error {
+	tx, err := t.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: t.isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	repositories := newRepositories(tx, t.timeout)
+	repositories.Transactor = joinedTransactor{repositories: &repositories}
+
+	err = fn(repositories)
+	if err != nil {
+		return err
+	}
+
+	return translateError(tx.Commit(ctx))
+}
+
+// joinedTransactor is the Transactor of repositories that already share a
+// transaction: WithinTx joins it instead of starting another one.
+type joinedTransactor struct {
+	repositories *Repositories
+}
+
+func (t joinedTransactor) WithinTx(ctx context.Context, fn func(Repositories) error) error {
+	return fn(*t.repositories)
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
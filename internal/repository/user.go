@@ -3,12 +3,10 @@ package repository
 import (
 	"context"
 	"crypto/sha256"
-	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/swsd2544/learny-backend-clone/internal/entity"
-	"log"
 	"time"
 )
 
@@ -17,80 +15,81 @@ var (
 )
 
 type UserRepository struct {
-	db *pgxpool.Pool
+	db      dbtx
+	timeout time.Duration
 }
 
-func (r UserRepository) Insert(user *entity.User) error {
+func (r UserRepository) Insert(ctx context.Context, user *entity.User) error {
 	query := `INSERT INTO users (username, firstname, lastname, email, hash_password,
-    coin, role) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, 
+    coin, role, activated) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, 
     created_at, version`
 
 	args := []any{user.Username, user.Firstname, user.Lastname, user.Email,
-		user.Password.Hash, user.Coin, user.Role}
+		user.Password.Hash, user.Coin, user.Role, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
-	err := r.db.QueryRow(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
-	if err != nil {
-		log.Println(err)
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		default:
-			return err
-		}
-	}
-
-	return nil
+	return r.db.QueryRow(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 }
 
-func (r UserRepository) GetUsersWithClassID(classID int64) ([]*entity.User, error) {
-	query := `SELECT users.id, users.firstname, users.lastname, users.email, 
-    users.hash_password, users.coin, users.role, users.version FROM users INNER JOIN enrollments
-    ON users.id = enrollments.user_id WHERE enrollments.class_id = $1`
+func (r UserRepository) GetUsersWithClassID(ctx context.Context, classID int64, filters Filters) ([]*entity.User, Metadata, error) {
+	condition, orderBy := filters.orderBy("users", nil, 4)
+
+	query := fmt.Sprintf(`SELECT count(*) OVER(), users.id, users.username, users.firstname, users.lastname,
+    users.email, users.hash_password, users.coin, users.role, users.activated, users.totp_enabled, users.version, users.character_id
+    FROM users INNER JOIN enrollments ON users.id = enrollments.user_id
+    WHERE enrollments.class_id = $1 AND %s ORDER BY %s LIMIT $2 OFFSET $3`, condition, orderBy)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []any{classID, filters.limit(), filters.offset()}
+	if filters.After != 0 {
+		args = append(args, filters.After)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
-	results, err := r.db.Query(ctx, query, classID)
+	results, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		switch {
-		case errors.Is(err, pgx.ErrNoRows):
-			return []*entity.User{}, nil
-		default:
-			return nil, err
-		}
+		return nil, Metadata{}, err
 	}
 	defer results.Close()
 
-	var users []*entity.User
+	totalRecords := 0
+	users := []*entity.User{}
 	for results.Next() {
 		var user entity.User
-		err := results.Scan(&user.ID, &user.Firstname, &user.Lastname, &user.Email, &user.Role)
+		err := results.Scan(&totalRecords, &user.ID, &user.Username, &user.Firstname, &user.Lastname,
+			&user.Email, &user.Password.Hash, &user.Coin, &user.Role, &user.Activated, &user.TOTPEnabled, &user.Version,
+			&user.CharacterID)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 		users = append(users, &user)
 	}
 
 	if err = results.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return users, nil
+	var lastID int64
+	if len(users) > 0 {
+		lastID = users[len(users)-1].ID
+	}
+
+	return users, calculateMetadata(filters, totalRecords, lastID, len(users)), nil
 }
 
-func (r UserRepository) GetUserWithID(userID int64) (*entity.User, error) {
-	query := `SELECT id, firstname, lastname, email, hash_password, 
-       coin, role, version FROM users WHERE id = $1`
+func (r UserRepository) GetUserWithID(ctx context.Context, userID int64) (*entity.User, error) {
+	query := `SELECT id, username, firstname, lastname, email, hash_password, 
+       coin, role, activated, totp_enabled, version, character_id FROM users WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	var user entity.User
-	err := r.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Firstname, &user.Lastname,
-		&user.Email, &user.Password.Hash, &user.Coin, &user.Role, &user.Version)
+	err := r.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Firstname, &user.Lastname,
+		&user.Email, &user.Password.Hash, &user.Coin, &user.Role, &user.Activated, &user.TOTPEnabled, &user.Version, &user.CharacterID)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -103,18 +102,18 @@ func (r UserRepository) GetUserWithID(userID int64) (*entity.User, error) {
 	return &user, nil
 }
 
-func (r UserRepository) GetUserWithEmail(email string) (*entity.User, error) {
+func (r UserRepository) GetUserWithEmail(ctx context.Context, email string) (*entity.User, error) {
 	query := `SELECT id, username, firstname, lastname, hash_password, 
-       coin, role, version, character_id FROM users WHERE email = $1`
+       coin, role, activated, totp_enabled, version, character_id FROM users WHERE email = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	user := entity.User{
 		Email: email,
 	}
 	err := r.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Username, &user.Firstname, &user.Lastname,
-		&user.Password.Hash, &user.Coin, &user.Role, &user.Version, &user.CharacterID)
+		&user.Password.Hash, &user.Coin, &user.Role, &user.Activated, &user.TOTPEnabled, &user.Version, &user.CharacterID)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -127,21 +126,21 @@ func (r UserRepository) GetUserWithEmail(email string) (*entity.User, error) {
 	return &user, nil
 }
 
-func (r UserRepository) GetUserWithToken(scope, tokenPlaintext string) (*entity.User, error) {
+func (r UserRepository) GetUserWithToken(ctx context.Context, scope, tokenPlaintext string) (*entity.User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `SELECT id, username, firstname, lastname, email, hash_password, 
-       coin, role, version, character_id FROM users INNER JOIN tokens ON users.id = tokens.user_id
+       coin, role, activated, totp_enabled, version, character_id FROM users INNER JOIN tokens ON users.id = tokens.user_id
        WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
 
 	args := []any{tokenHash[:], scope, time.Now()}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
 	var user entity.User
 	err := r.db.QueryRow(ctx, query, args...).Scan(&user.ID, &user.Username, &user.Firstname, &user.Lastname,
-		&user.Password.Hash, &user.Coin, &user.Role, &user.Version, &user.CharacterID)
+		&user.Email, &user.Password.Hash, &user.Coin, &user.Role, &user.Activated, &user.TOTPEnabled, &user.Version, &user.CharacterID)
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -154,28 +153,33 @@ func (r UserRepository) GetUserWithToken(scope, tokenPlaintext string) (*entity.
 	return &user, nil
 }
 
-func (r UserRepository) Update(user *entity.User) error {
-	query := `UPDATE users SET firstname=$1, lastname=$2, email=$3, hash_password=$4, 
-    coin=$5, role=$6, version = version + 1 WHERE id = $7 AND version = $8 RETURNING version`
+// Update writes the user's profile fields. The coin balance is owned by
+// CoinRepository and is only read back here, never written.
+func (r UserRepository) Update(ctx context.Context, user *entity.User) error {
+	query := `UPDATE users SET username=$1, firstname=$2, lastname=$3, email=$4, hash_password=$5,
+    role=$6, activated=$7, character_id=$8, version = version + 1 WHERE id = $9 AND version = $10
+    RETURNING version, coin`
 
 	args := []any{
+		user.Username,
 		user.Firstname,
 		user.Lastname,
 		user.Email,
 		user.Password.Hash,
-		user.Coin,
 		user.Role,
+		user.Activated,
+		user.CharacterID,
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
 	defer cancel()
 
-	err := r.db.QueryRow(ctx, query, args...).Scan(&user.Version)
+	err := r.db.QueryRow(ctx, query, args...).Scan(&user.Version, &user.Coin)
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, pgx.ErrNoRows):
 			return ErrEditConflict
 		default:
 			return err
@@ -184,3 +188,48 @@ func (r UserRepository) Update(user *entity.User) error {
 
 	return nil
 }
+
+// SetPendingEmail records the address the user asked to change their email
+// to. It only replaces the current email once confirmed through
+// ConfirmPendingEmail.
+func (r UserRepository) SetPendingEmail(ctx context.Context, userID int64, email string) error {
+	query := `UPDATE users SET pending_email = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := r.db.Exec(ctx, query, email, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ConfirmPendingEmail swaps the user's email for the pending one. It returns
+// ErrRecordNotFound if there is no pending email and ErrDuplicateEmail if
+// another account took the address in the meantime.
+func (r UserRepository) ConfirmPendingEmail(ctx context.Context, user *entity.User) error {
+	query := `UPDATE users SET email = pending_email, pending_email = NULL, version = version + 1
+    WHERE id = $1 AND pending_email IS NOT NULL
+    RETURNING email, version`
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := r.db.QueryRow(ctx, query, user.ID).Scan(&user.Email, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
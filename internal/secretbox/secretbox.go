@@ -0,0 +1,62 @@
+// Package secretbox encrypts small secrets, such as TOTP seeds, before they
+// are written to the database.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Box seals data with AES-256-GCM. Every sealed value carries its own random
+// nonce in front of the ciphertext.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (Box, error) {
+	if len(key) != 32 {
+		return Box{}, errors.New("secretbox key must be 32 bytes long")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return Box{}, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return Box{}, err
+	}
+
+	return Box{aead: aead}, nil
+}
+
+func (b Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (b Box) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,116 @@
+package secretbox
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newBox(t *testing.T) Box {
+	t.Helper()
+
+	box, err := New(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return box
+}
+
+func TestRoundTrip(t *testing.T) {
+	box := newBox(t)
+	plaintext := []byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+
+	sealed, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed value contains the plaintext")
+	}
+
+	again, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Fatal("sealing twice gave the same value")
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("got %q, want %q", opened, plaintext)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	box := newBox(t)
+
+	sealed, err := box.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonceSize := box.aead.NonceSize()
+
+	tests := []struct {
+		name   string
+		sealed func() []byte
+	}{
+		{"ciphertext", func() []byte {
+			s := append([]byte(nil), sealed...)
+			s[nonceSize] ^= 1
+			return s
+		}},
+		{"tag", func() []byte {
+			s := append([]byte(nil), sealed...)
+			s[len(s)-1] ^= 1
+			return s
+		}},
+		{"nonce", func() []byte {
+			s := append([]byte(nil), sealed...)
+			s[0] ^= 1
+			return s
+		}},
+		{"truncated", func() []byte { return sealed[:nonceSize-1] }},
+		{"empty", func() []byte { return nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := box.Open(tt.sealed())
+			if !errors.Is(err, ErrInvalidCiphertext) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidCiphertext)
+			}
+		})
+	}
+}
+
+func TestOpenRejectsOtherKey(t *testing.T) {
+	sealed, err := newBox(t).Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := New(bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = other.Open(sealed)
+	if !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidCiphertext)
+	}
+}
+
+func TestNewKeyLength(t *testing.T) {
+	for _, length := range []int{0, 16, 24, 31, 33, 64} {
+		_, err := New(make([]byte, length))
+		if err == nil {
+			t.Fatalf("a key of %d bytes was accepted", length)
+		}
+	}
+}
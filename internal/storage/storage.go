@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Blob stores opaque files under slash separated keys such as
+// "characters/3f2a.png" and knows the public URL each one is served from.
+type Blob interface {
+	Put(key string, r io.Reader) error
+	Delete(key string) error
+	URL(key string) string
+}
@@ -0,0 +1,122 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters authenticator apps expect: HMAC-SHA1, 6 digits, 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and verifies codes. Now is the clock codes are checked
+// against; tests replace it to verify codes offline. Skew is how many steps
+// before and after the current one are still accepted.
+type TOTP struct {
+	Period time.Duration
+	Digits int
+	Skew   int64
+	Now    func() time.Time
+}
+
+func New() TOTP {
+	return TOTP{
+		Period: 30 * time.Second,
+		Digits: 6,
+		Skew:   1,
+		Now:    time.Now,
+	}
+}
+
+// GenerateSecret returns a random 160 bit secret encoded as unpadded base32.
+func GenerateSecret() (string, error) {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(randomBytes), nil
+}
+
+// URI returns the otpauth:// URI that authenticator apps read from a QR code.
+func (t TOTP) URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(t.Digits))
+	v.Set("period", fmt.Sprint(int64(t.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// Step returns the time step t falls in.
+func (t TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code returns the code of the secret for the given time step.
+func (t TOTP) Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, value%mod), nil
+}
+
+// Validate checks code against the steps around the current time and returns
+// the step it matched. Callers must reject steps at or before the last one
+// accepted for the secret, otherwise a code can be replayed.
+func (t TOTP) Validate(secret, code string) (int64, bool, error) {
+	if len(code) != t.Digits {
+		return 0, false, nil
+	}
+
+	current := t.Step(t.Now())
+
+	for step := current - t.Skew; step <= current+t.Skew; step++ {
+		expected, err := t.Code(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,133 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 Appendix B, the ASCII string
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func at(unix int64) func() time.Time {
+	return func() time.Time { return time.Unix(unix, 0) }
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			totp := New()
+			totp.Digits = 8
+			totp.Skew = 0
+			totp.Now = at(tt.unix)
+
+			got, err := totp.Code(rfcSecret, totp.Step(totp.Now()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.code {
+				t.Fatalf("got code %s at %d, want %s", got, tt.unix, tt.code)
+			}
+
+			step, ok, err := totp.Validate(rfcSecret, tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || step != tt.unix/30 {
+				t.Fatalf("got step %d, ok %t validating at %d, want step %d", step, ok, tt.unix, tt.unix/30)
+			}
+		})
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	totp := New()
+	totp.Now = at(1234567890)
+	current := totp.Step(totp.Now())
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -1, true},
+		{"next step", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totp.Code(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok, err := totp.Validate(rfcSecret, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("got ok %t for a code %d steps off, want %t", ok, tt.offset, tt.want)
+			}
+			if ok && step != current+tt.offset {
+				t.Fatalf("got step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateMalformedCodes(t *testing.T) {
+	totp := New()
+	totp.Now = at(1234567890)
+
+	code, err := totp.Code(rfcSecret, totp.Step(totp.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"empty", ""},
+		{"short", code[:5]},
+		{"long", code + "0"},
+		{"letters", "abcdef"},
+		{"padded", " " + code[:5]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := totp.Validate(rfcSecret, tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				t.Fatalf("code %q was accepted", tt.code)
+			}
+		})
+	}
+}
+
+func TestValidateMalformedSecret(t *testing.T) {
+	totp := New()
+
+	_, ok, err := totp.Validate("not base32!", "123456")
+	if err == nil || ok {
+		t.Fatalf("got ok %t, error %v, want an error", ok, err)
+	}
+}
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS activated;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated bool NOT NULL DEFAULT false;
+
+UPDATE users SET activated = true;
+
+COMMIT;
\ No newline at end of file
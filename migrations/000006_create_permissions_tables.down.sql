@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,25 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code) VALUES
+    ('classes:read'),
+    ('classes:write'),
+    ('coins:grant'),
+    ('characters:manage');
+
+INSERT INTO users_permissions
+    SELECT users.id, permissions.id FROM users, permissions
+    WHERE permissions.code = 'classes:read'
+       OR (users.role = 'teacher' AND permissions.code IN ('classes:write', 'coins:grant'));
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE enrollments
+    DROP CONSTRAINT IF EXISTS enrollments_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS enrollments_class_id_fkey,
+    ADD CONSTRAINT enrollments_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    ADD CONSTRAINT enrollments_class_id_fkey FOREIGN KEY (class_id) REFERENCES classes(id) ON DELETE CASCADE;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE enrollments DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE classes DROP COLUMN IF EXISTS join_code;
+
+COMMIT;
\ No newline at end of file
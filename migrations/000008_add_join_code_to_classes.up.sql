@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS join_code text UNIQUE;
+
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS created_at timestamp NOT NULL DEFAULT NOW();
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS coin_transactions;
+DROP FUNCTION IF EXISTS coin_transactions_append_only();
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_coin_check;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,29 @@
+BEGIN;
+
+ALTER TABLE users ADD CONSTRAINT users_coin_check CHECK (coin >= 0);
+
+CREATE TABLE IF NOT EXISTS coin_transactions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users,
+    delta bigint NOT NULL CHECK (delta <> 0),
+    reason text NOT NULL,
+    actor_id bigint REFERENCES users,
+    class_id bigint,
+    idempotency_key text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS coin_transactions_user_id_idx ON coin_transactions (user_id, id);
+
+CREATE OR REPLACE FUNCTION coin_transactions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'coin_transactions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER coin_transactions_append_only
+    BEFORE UPDATE OR DELETE ON coin_transactions
+    FOR EACH ROW EXECUTE FUNCTION coin_transactions_append_only();
+
+COMMIT;
\ No newline at end of file
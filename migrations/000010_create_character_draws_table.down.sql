@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS character_draws;
+
+ALTER TABLE users DROP COLUMN IF EXISTS gacha_pity;
+
+COMMIT;
\ No newline at end of file
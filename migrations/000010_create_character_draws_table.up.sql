@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS gacha_pity integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS character_draws (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    character_id bigint NOT NULL REFERENCES characters,
+    rarity text NOT NULL,
+    coin_transaction_id bigint NOT NULL REFERENCES coin_transactions,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS character_draws_user_id_idx ON character_draws (user_id);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS user_characters (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    character_id bigint NOT NULL REFERENCES characters,
+    count bigint NOT NULL DEFAULT 1 CHECK (count > 0),
+    acquired_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, character_id)
+);
+
+INSERT INTO user_characters (user_id, character_id, count, acquired_at)
+    SELECT user_id, character_id, count(*), min(created_at) FROM character_draws
+    GROUP BY user_id, character_id;
+
+INSERT INTO user_characters (user_id, character_id)
+    SELECT id, character_id FROM users
+    ON CONFLICT DO NOTHING;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE characters DROP COLUMN IF EXISTS retired;
+
+COMMIT;
\ No newline at end of file
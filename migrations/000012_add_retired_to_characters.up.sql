@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE characters ADD COLUMN IF NOT EXISTS retired bool NOT NULL DEFAULT false;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS tokens_family_idx;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family text,
+    ADD COLUMN IF NOT EXISTS rotated_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,12 @@
+BEGIN;
+
+DROP INDEX IF EXISTS tokens_user_id_idx;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS id;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS tokens_expiry_idx;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS tokens_expiry_idx ON tokens (expiry);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+DELETE FROM permissions WHERE code = 'users:manage';
+
+DROP TABLE IF EXISTS login_failures;
+
+COMMIT;
\ No newline at end of file
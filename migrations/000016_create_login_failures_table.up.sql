@@ -0,0 +1,12 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    key text PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone
+);
+
+INSERT INTO permissions (code) VALUES ('users:manage') ON CONFLICT DO NOTHING;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE IF EXISTS totp_recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_secret;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+
+COMMIT;
\ No newline at end of file
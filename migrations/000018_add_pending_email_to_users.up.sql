@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS login_failures_expires_at_idx;
+
+ALTER TABLE login_failures DROP COLUMN IF EXISTS expires_at;
+
+COMMIT;
\ No newline at end of file
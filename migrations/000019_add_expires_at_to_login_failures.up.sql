@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE login_failures ADD COLUMN IF NOT EXISTS expires_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+UPDATE login_failures SET expires_at = GREATEST(locked_until, last_failure_at + interval '1 day');
+
+CREATE INDEX IF NOT EXISTS login_failures_expires_at_idx ON login_failures (expires_at);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,19 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coin_transactions_class_id_idx;
+DROP INDEX IF EXISTS coin_transactions_actor_id_idx;
+
+ALTER TABLE coin_transactions
+    DROP CONSTRAINT IF EXISTS coin_transactions_class_id_fkey,
+    DROP CONSTRAINT IF EXISTS coin_transactions_actor_id_fkey,
+    DROP CONSTRAINT IF EXISTS coin_transactions_user_id_fkey,
+    ADD CONSTRAINT coin_transactions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users,
+    ADD CONSTRAINT coin_transactions_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users;
+
+CREATE OR REPLACE FUNCTION coin_transactions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'coin_transactions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+COMMIT;
\ No newline at end of file
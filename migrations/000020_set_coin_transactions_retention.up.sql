@@ -0,0 +1,37 @@
+BEGIN;
+
+-- Ledger entries are removed together with their user and otherwise never
+-- change, except that they forget an actor or a class once it is deleted.
+CREATE OR REPLACE FUNCTION coin_transactions_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF NOT EXISTS (SELECT 1 FROM users WHERE id = OLD.user_id) THEN
+            RETURN OLD;
+        END IF;
+    ELSIF (NEW.id, NEW.user_id, NEW.delta, NEW.reason, NEW.idempotency_key, NEW.created_at)
+            IS NOT DISTINCT FROM (OLD.id, OLD.user_id, OLD.delta, OLD.reason, OLD.idempotency_key, OLD.created_at)
+        AND (NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+            OR (NEW.actor_id IS NULL AND NOT EXISTS (SELECT 1 FROM users WHERE id = OLD.actor_id)))
+        AND (NEW.class_id IS NOT DISTINCT FROM OLD.class_id
+            OR (NEW.class_id IS NULL AND NOT EXISTS (SELECT 1 FROM classes WHERE id = OLD.class_id))) THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION 'coin_transactions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE coin_transactions SET class_id = NULL
+    WHERE class_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM classes WHERE classes.id = class_id);
+
+ALTER TABLE coin_transactions
+    DROP CONSTRAINT IF EXISTS coin_transactions_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS coin_transactions_actor_id_fkey,
+    ADD CONSTRAINT coin_transactions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE,
+    ADD CONSTRAINT coin_transactions_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users ON DELETE SET NULL,
+    ADD CONSTRAINT coin_transactions_class_id_fkey FOREIGN KEY (class_id) REFERENCES classes ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS coin_transactions_actor_id_idx ON coin_transactions (actor_id);
+CREATE INDEX IF NOT EXISTS coin_transactions_class_id_idx ON coin_transactions (class_id);
+
+COMMIT;
\ No newline at end of file
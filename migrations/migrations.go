@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations into the binary so that it can
+// apply them itself through internal/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS